@@ -1,9 +1,31 @@
 module github.com/mattlaibybit/gowp
 
-go 1.14
+go 1.20
 
 require (
 	github.com/gomodule/redigo v1.8.8
 	github.com/mattlaibybit/public v0.0.0-20220120124844-d6bce65dbe23
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	github.com/prometheus/client_golang v1.19.1
+	golang.org/x/sync v0.3.0
+)
+
+require (
+	github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/gookit/color v1.2.5 // indirect
+	github.com/muesli/cache2go v0.0.0-20200423001931-a100c5aac93f // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	go.uber.org/atomic v1.4.0 // indirect
+	go.uber.org/multierr v1.1.0 // indirect
+	go.uber.org/zap v1.10.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55 // indirect
+	google.golang.org/grpc v1.29.1 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
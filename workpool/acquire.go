@@ -0,0 +1,69 @@
+package workpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Acquire Borrow a worker slot to run inline code under the concurrency limit of the pool, like semaphore.Weighted
+// The slot is handed out in submission order with the tasks and held until release is called, Wait waits for it,
+// returns ctx.Err() once ctx is done first and ErrPoolClosed if the pool stopped
+func (p *WorkPool) Acquire(ctx context.Context) (release func(), err error) { // 借用一个worker名额，在调用方协程中执行，release 归还
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	gaveUp := false
+	granted := make(chan struct{})
+	j := &job{fn: func(context.Context) error { return nil }} // never run. 不会执行
+	j.lend = func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if gaveUp {
+			return false
+		}
+		close(granted)
+		return true
+	}
+	if err := p.pushFull(ctx, j, p.whenFull); err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() { p.giveBack(j) })
+	}
+	select {
+	case <-granted:
+		return release, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-p.ctx.Done(): // the queue is discarded. 队列已丢弃
+		err = ErrPoolClosed
+	}
+
+	mu.Lock()
+	gaveUp = true
+	mu.Unlock()
+	select {
+	case <-granted: // lent meanwhile. 期间已借出
+		release()
+	default:
+	}
+	return nil, err
+}
+
+// lend Hand the acquired slot of the job to the caller of Acquire
+func (p *WorkPool) lend(j *job) { // 借出worker名额
+	p.wg.Add(1)    // Wait waits for the slot. 等待归还
+	if !j.lend() { // the caller gave up. 调用方已放弃
+		p.giveBack(j)
+	}
+}
+
+// giveBack Return a slot lent by Acquire
+func (p *WorkPool) giveBack(j *job) { // 归还借出的worker名额
+	p.release(j)
+	p.finish(j)
+	p.wg.Done()
+}
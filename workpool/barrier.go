@@ -0,0 +1,65 @@
+package workpool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// epoch Tasks submitted between two barriers
+type epoch struct {
+	pending int64         // unfinished tasks, plus one until the next barrier starts. 未结束的任务数
+	drained chan struct{} // closed once pending drops to zero. 全部结束时关闭
+	once    sync.Once
+}
+
+func newEpoch() *epoch {
+	return &epoch{pending: 1, drained: make(chan struct{})}
+}
+
+// leave Mark one task of the epoch finished
+func (e *epoch) leave() { // 任务结束
+	if e == nil {
+		return
+	}
+	if atomic.AddInt64(&e.pending, -1) == 0 {
+		e.once.Do(func() { close(e.drained) })
+	}
+}
+
+// joinEpoch Count a new task in the current epoch
+func (p *WorkPool) joinEpoch() *epoch { // 加入当前批次
+	for {
+		e := p.epoch.Load()
+		atomic.AddInt64(&e.pending, 1)
+		if p.epoch.Load() == e {
+			return e
+		}
+		e.leave() // a barrier started meanwhile, join the next epoch. 期间有新的屏障，加入下一批次
+	}
+}
+
+// Barrier Return a channel closed once every task submitted before the call has finished, the pool stays open
+// Tasks submitted afterwards are not waited for and each barrier is independent of the others,
+// the channel is also closed once the pool is canceled and the remaining tasks are abandoned
+func (p *WorkPool) Barrier() <-chan struct{} { // 屏障: 此前提交的任务全部结束时关闭返回的通道，不关闭工作池
+	ch := make(chan struct{})
+	p.mu.Lock()
+	e := p.epoch.Swap(newEpoch())
+	prev, ctx := p.barrier, p.ctx
+	p.barrier = ch
+	p.mu.Unlock()
+	e.leave()
+
+	go func() {
+		defer close(ch)
+		select {
+		case <-e.drained:
+		case <-ctx.Done(): // queued tasks are discarded. 排队的任务已丢弃
+			return
+		}
+		if prev != nil { // tasks of the earlier epochs. 更早批次的任务
+			<-prev
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,120 @@
+package workpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DoBatch Add all the tasks to the workpool and return immediately with the number of tasks submitted
+// Submission stops at the first refused task, e.g. ErrPoolClosed or ErrQueueFull, fns[submitted:] were not added
+func (p *WorkPool) DoBatch(fns []TaskHandler) (submitted int, err error) { // 批量添加到工作池，并立即返回已提交的任务数
+	for _, fn := range fns {
+		if err := p.Do(fn); err != nil {
+			return submitted, err
+		}
+		submitted++
+	}
+	return submitted, nil
+}
+
+// RunAll Run the tasks with at most max concurrent calls and return the first error, like ForEach for plain tasks
+// The pool is created and waited for here, every goroutine has exited once it returns
+func RunAll(max int, fns ...TaskHandler) error { // 并发执行全部任务，返回首个错误并停止剩余任务
+	p := New(max)
+	for _, fn := range fns {
+		if p.Do(fn) != nil { // stopped by an error. 已出错停止
+			break
+		}
+	}
+	return p.Wait()
+}
+
+// DoBatchWait Add all the tasks to the workpool and wait for the whole batch, return the first error
+// Unlike Wait the pool stays open afterwards
+func (p *WorkPool) DoBatchWait(fns []TaskHandler) error { // 批量添加到工作池，等待这批任务结束，返回第一个错误（不关闭工作池）
+	var (
+		mu    sync.Mutex
+		first error
+	)
+	setFirst := func(err error) {
+		mu.Lock()
+		if first == nil {
+			first = err
+		}
+		mu.Unlock()
+	}
+
+	var left int32 = 1 // released after submitting. 提交完成后释放
+	done := make(chan struct{})
+	finish := func() {
+		if atomic.AddInt32(&left, -1) == 0 {
+			close(done)
+		}
+	}
+	for _, fn := range fns {
+		if fn == nil {
+			continue
+		}
+		fn := fn
+		atomic.AddInt32(&left, 1)
+		err := p.push(&job{fn: func(context.Context) error {
+			defer finish()
+			err := p.safeRun(fn)
+			if err != nil {
+				setFirst(err)
+			}
+			return err
+		}})
+		if err != nil { // closed
+			finish()
+			setFirst(err)
+			break
+		}
+	}
+	finish()
+
+	select {
+	case <-done:
+	case <-p.ctx.Done(): // the rest of the batch will not run. 剩余任务不会再执行
+		setFirst(ErrPoolClosed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return first
+}
+
+// SubmitAll Run every task and return their errors by position, errs[i] is the result of fns[i]
+// The errors are returned only, they do not stop the pool in fail-fast mode nor reach Wait,
+// a task the pool could not run gets ErrPoolClosed, the pool stays open afterwards
+func (p *WorkPool) SubmitAll(fns []TaskHandler) []error { // 执行全部任务，按位置返回每个任务的错误（不触发快速失败，不关闭工作池）
+	errs := make([]error, len(fns))
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		if fn == nil {
+			continue
+		}
+		i, fn := i, fn
+		wg.Add(1)
+		var once sync.Once
+		done := func(err error) {
+			once.Do(func() {
+				errs[i] = err
+				wg.Done()
+			})
+		}
+		if err := p.push(&job{
+			fn: func(context.Context) error {
+				done(p.safeRun(fn))
+				return nil
+			},
+			drop: func() {
+				done(ErrPoolClosed)
+			},
+		}); err != nil { // closed
+			done(err)
+		}
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,96 @@
+package workpool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock Source of time for the task timeouts, deadlines, retry backoff and the timed waits, see WithClock
+// The default is the system clock, tests inject a fake one to advance time without sleeping
+type Clock interface {
+	Now() time.Time                            // current time. 当前时间
+	After(d time.Duration) <-chan time.Time    // like time.After
+	NewTimer(d time.Duration) Timer            // like time.NewTimer
+	AfterFunc(d time.Duration, f func()) Timer // like time.AfterFunc, f runs in its own goroutine. f 在单独的协程中执行
+}
+
+// Timer Timer created by a Clock
+type Timer interface {
+	C() <-chan time.Time // fires once, nil for AfterFunc timers. 触发通道
+	Stop() bool          // like time.Timer.Stop
+}
+
+// realClock the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// withDeadline context.WithDeadline on the pool clock, the context package only knows the system clock
+// On another clock it returns a *clockContext, the caller expires it from its own timer so the task context is done before the timeout is reported
+func (p *WorkPool) withDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) { // 按工作池时钟设置截止时间
+	if _, ok := p.clock.(realClock); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	ct, cancel := context.WithCancel(ctx)
+	return &clockContext{Context: ct, parent: ctx, deadline: deadline, cancel: cancel}, cancel
+}
+
+// clockContext context with a deadline driven by a Clock
+type clockContext struct {
+	context.Context
+	parent   context.Context
+	deadline time.Time
+	cancel   context.CancelFunc
+	timer    wheelTimer // timer of the deadline on a timer wheel, saves an allocation. 时间轮上的定时器
+	mu       sync.Mutex
+	err      error // DeadlineExceeded once the clock fired. 到期后为 DeadlineExceeded
+}
+
+// afterFunc clock.AfterFunc, a timer wheel keeps the timer in the context
+func (c *clockContext) afterFunc(clock Clock, d time.Duration, f func()) Timer {
+	if w, ok := clock.(*timerWheel); ok {
+		c.timer.f = f
+		return w.add(&c.timer, d)
+	}
+	return clock.AfterFunc(d, f)
+}
+
+// expire Mark the deadline exceeded and cancel, like the timer of context.WithDeadline
+func (c *clockContext) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Context.Err() == nil {
+		c.err = context.DeadlineExceeded
+	}
+	c.cancel()
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.Context.Err()
+}
+
+// Value Values of the parent, hiding the inner cancel context so derived contexts inherit Err from this one
+func (c *clockContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
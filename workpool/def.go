@@ -1,22 +1,292 @@
 package workpool
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+)
+
+var (
+	// ErrPoolCanceled returned by Wait after the pool was canceled
+	ErrPoolCanceled = errors.New("workpool: pool canceled") // 工作池已取消
+	// ErrPoolClosed returned by the submission methods once the pool was closed by Wait,
+	// Cancel or a failed task, and when the pool stopped before the task could run
+	ErrPoolClosed = errors.New("workpool: pool closed") // 工作池已关闭
+	// ErrWaitTimeout returned when waiting did not finish in time
+	ErrWaitTimeout = errors.New("workpool: wait timeout") // 等待超时
+	// ErrQueueFull returned by the submission methods when the queue is full, see WithBlockWhenFull
+	ErrQueueFull = errors.New("workpool: queue full") // 队列已满
+	// ErrNilTask reported for a nil task with NilTaskError, the panic value with NilTaskPanic
+	ErrNilTask = errors.New("workpool: nil task") // 空任务
+	// ErrWeightTooLarge returned by DoWeighted for a weight above the number of workers
+	ErrWeightTooLarge = errors.New("workpool: weight exceeds max workers") // 权重超过worker数
+	// ErrPoolRunning returned by Reset before Wait returned
+	ErrPoolRunning = errors.New("workpool: pool still running") // 工作池仍在运行
+)
+
+// What a submission does once the queue holds WithQueueSize tasks
+const (
+	fullGrow     = iota // the waiting queue grows. 队列继续增长
+	fullBlock           // wait for a free slot. 阻塞等待
+	fullError           // return ErrQueueFull. 返回 ErrQueueFull
+	fullResubmit        // Resubmit: the queue grows, accepted while Wait runs the queue. 队列继续增长，Wait 期间仍接受
+)
 
-	"github.com/mattlaibybit/public/myqueue"
+// Unbounded max for New: every task runs in its own goroutine without any concurrency cap
+// Memory grows with the number of tasks running at once (a goroutine stack each), keep the submission rate bounded
+const Unbounded = 0
+
+// progressInterval How often WaitProgress reports
+const progressInterval = 100 * time.Millisecond
+
+// NilTaskPolicy How a nil task submitted to the pool is handled
+type NilTaskPolicy int
+
+const (
+	// NilTaskSkip nil tasks are skipped silently (default). 忽略空任务(默认)
+	NilTaskSkip NilTaskPolicy = iota
+	// NilTaskError a nil task fails with ErrNilTask. 空任务按 ErrNilTask 错误处理
+	NilTaskError
+	// NilTaskPanic submitting a nil task panics with ErrNilTask, meant for development. 提交空任务时 panic
+	NilTaskPanic
+)
+
+// PanicPolicy How a panicking task is handled
+type PanicPolicy int
+
+const (
+	// PanicAsError the panic is recovered and becomes the task error (default). 转换为任务错误(默认)
+	PanicAsError PanicPolicy = iota
+	// PanicIgnore the panic is recovered and the task counts as successful. 忽略，任务视为成功
+	PanicIgnore
+	// PanicCrash the pool stops and Wait panics again with the value and stack, meant for tests. 停止工作池，Wait 重新 panic
+	PanicCrash
+)
+
+// ErrorOverflow How the Errors stream handles an error while its buffer is full
+type ErrorOverflow int
+
+const (
+	// ErrorBlock the failing task waits until the error is received (default). 等待读取(默认)
+	ErrorBlock ErrorOverflow = iota
+	// ErrorDropNewest the new error is not streamed. 丢弃新的错误
+	ErrorDropNewest
+	// ErrorDropOldest the oldest buffered error is discarded to make room. 丢弃最旧的错误
+	ErrorDropOldest
+)
+
+// ResultOverflow How the Results stream of a typed pool handles a result while its buffer is full
+type ResultOverflow int
+
+const (
+	// ResultBlock the worker waits until the result is received (default). 等待读取(默认)
+	ResultBlock ResultOverflow = iota
+	// ResultDropNewest the new result is not streamed. 丢弃新的结果
+	ResultDropNewest
+	// ResultDropOldest the oldest buffered result is discarded to make room. 丢弃最旧的结果
+	ResultDropOldest
 )
 
 // TaskHandler Define function callbacks
 type TaskHandler func() error
 
+// TaskHandlerCtx Define function callbacks receiving a context
+// The context is derived from the pool context and canceled on timeout or when the pool stops
+type TaskHandlerCtx func(ctx context.Context) error
+
+// withContext adapt a TaskHandler to TaskHandlerCtx
+func (fn TaskHandler) withContext() TaskHandlerCtx {
+	if fn == nil {
+		return nil
+	}
+	return func(context.Context) error {
+		return fn()
+	}
+}
+
+// job a queued task with its own settings
+type job struct {
+	fn         TaskHandlerCtx
+	timeout    time.Duration // per-task timeout. 单个任务的超时时间
+	hasTimeout bool          // timeout overrides the pool timeout. 是否覆盖工作池的超时
+	deadline   time.Time     // per-task deadline, zero if none. 单个任务的截止时间
+	priority   int           // higher runs first. 优先级
+	seq        uint64        // submission order. 提交顺序
+	drop       func()        // called when the job is discarded without running. 任务被丢弃时调用
+	id         string        // identifies the task in its errors, empty if none. 任务标识
+	started    chan struct{} // closed when the task starts in FIFO mode or for DoSync, nil otherwise. FIFO 模式或 DoSync 时任务开始时关闭
+	begun      bool          // started is closed, only used by the executing worker. 已关闭 started
+	weight     int32         // worker slots held while running, 0 means 1. 执行时占用的worker数
+	epoch      *epoch        // barrier epoch the job was submitted in. 提交时的屏障批次
+	lend       func() bool   // hands the slot to Acquire, false if the caller gave up. 借出名额
+	handler    TaskHandler   // the task as submitted, nil if it takes a context. 提交时的任务
+	onWait     func()        // DoAdmit callback before the submission blocks. 提交阻塞前的回调
+	key        string        // DoKeyed routing key. 路由键
+	keyed      bool          // submitted by DoKeyed. 由 DoKeyed 提交
+}
+
+// slots Number of worker slots the job holds while running
+func (j *job) slots() int32 {
+	if j.weight < 1 {
+		return 1
+	}
+	return j.weight
+}
+
+// begin Tell the FIFO dispatcher or DoSync that the job started
+func (j *job) begin() {
+	if j.started != nil && !j.begun {
+		j.begun = true
+		close(j.started)
+	}
+}
+
+// wrapErr Prefix err with the task id, if any
+func (j *job) wrapErr(err error) error {
+	if j == nil || j.id == "" || err == nil {
+		return err
+	}
+	return fmt.Errorf("task %s: %w", j.id, err)
+}
+
+// abandon Tell the submitter that the job was discarded without running
+func (j *job) abandon() {
+	if j != nil && j.drop != nil {
+		j.drop()
+	}
+}
+
+// Logger Logs task errors and timeouts, e.g. mylog, zap or logrus
+type Logger interface {
+	Error(a ...interface{})
+}
+
+// ErrorHandler Callback with every task error and timeout, e.g. to feed metrics
+type ErrorHandler func(err error)
+
+// DeadLetterHandler Callback with every failed task and its error, task is the handler as submitted, so it can run again
+type DeadLetterHandler func(task TaskHandler, err error)
+
+// CompleteHandler Callback with the duration and error of every finished task
+type CompleteHandler func(d time.Duration, err error)
+
+// Middleware Wraps the execution of a task, call next to run it
+type Middleware func(next TaskHandler) TaskHandler
+
+// WorkerHandler Callback with the id of a worker goroutine, stable for the lifetime of the worker
+type WorkerHandler func(workerID int)
+
+// PanicHandler Callback with the recovered value and stack of a panicking task
+type PanicHandler func(recovered interface{}, stack []byte)
+
 // WorkPool serves incoming connections via a pool of workers
+//
+// Synchronization: the int32/int64 flags and counters (including timeout and deadline) are only
+// accessed through sync/atomic, mu guards the error list and stream, the event stream, the WaitN
+// waiters, the stopping flag, the pause, drain and barrier state, the callbacks and worker spawning, every
+// other field is set by New or Reset before any goroutine of the run starts and is read-only afterwards,
+// Reset sets them under mu since a Burst timer of the last run may still be pending
 type WorkPool struct {
-	closed       int32
-	isQueTask    int32         // Mark whether queue retrieval is task. 标记是否队列取出任务
-	errChan      chan error    // error chan
-	timeout      time.Duration // max timeout
-	wg           sync.WaitGroup
-	task         chan TaskHandler
-	waitingQueue *myqueue.MyQueue
+	closed             int32                              // Mark whether the pool stopped accepting tasks. 标记是否已关闭
+	canceled           int32                              // Mark whether Cancel was called. 标记是否已调用Cancel
+	shutdown           int32                              // Mark whether Shutdown was called. 标记是否已调用Shutdown
+	isQueTask          int32                              // Mark whether queue retrieval is task. 标记是否队列取出任务
+	dispatching        int32                              // Mark whether a popped task waits for the worker buffer. 标记是否有任务等待放入worker通道
+	workers            int32                              // running workers. 当前worker数
+	live               int32                              // goroutines running tasks, see GoroutineCount. 存活的执行任务的协程数
+	maxWorkers         int32                              // target number of workers. 设定的worker数
+	burst              int                                // workers added by running bursts, guarded by mu. Burst 临时增加的worker数
+	running            int32                              // tasks being executed. 执行中的任务数
+	used               int32                              // worker slots held by dispatched tasks, see DoWeighted. 已占用的worker名额
+	workerSeq          int32                              // last worker id handed out. 最后分配的worker编号
+	completed          int64                              // tasks finished without error. 成功的任务数
+	failed             int64                              // tasks finished with an error. 失败的任务数
+	panics             int64                              // recovered task panics. 任务 panic 次数
+	timeouts           int64                              // tasks that exceeded their timeout or deadline. 超时的任务数
+	lastActivity       int64                              // unix nanoseconds of the last task start or finish. 最近一次任务开始或结束的时间
+	submitted          int64                              // tasks accepted since the pool started. 已提交的任务数
+	settled            int64                              // submitted tasks over, run or not, see WaitProgress. 已结束(含未执行)的已提交任务数
+	outstanding        int64                              // tasks submitted and not finished yet. 已提交未结束的任务数
+	errChan            chan error                         // first error in fail-fast mode, buffer of one, later errors are dropped. 快速失败的首个错误
+	timeout            int64                              // max timeout in nanoseconds, read atomically by the workers. 超时时间(原子读写)
+	deadline           int64                              // pool deadline in unix nanoseconds, 0 if none, read atomically. 截止时间(原子读写)
+	panicHandler       PanicHandler                       // panic callback, guarded by mu. panic 回调
+	errorHandler       ErrorHandler                       // error callback, guarded by mu. 错误回调
+	onComplete         CompleteHandler                    // completion callback, guarded by mu. 任务结束回调
+	deadLetter         DeadLetterHandler                  // called with every failed task. 任务失败回调
+	onWorkerStart      WorkerHandler                      // worker goroutine start callback. worker启动回调
+	onWorkerStop       WorkerHandler                      // worker goroutine stop callback. worker退出回调
+	openWorkerValue    func(workerID int) interface{}     // creates the value of a worker. 创建worker独占值
+	closeWorkerValue   func(v interface{})                // releases the value of a worker. 释放worker独占值
+	taskWrapper        func(task TaskHandler) TaskHandler // SetTaskWrapper middleware, guarded by mu. 任务中间件
+	middlewares        []Middleware                       // Use middlewares in order, guarded by mu. 中间件列表
+	chain              Middleware                         // middlewares and taskWrapper composed, nil if none, guarded by mu. 组合后的中间件
+	logger             Logger                             // error logger, nil logs nothing. 错误日志
+	name               string                             // WithName name, prefixes the logged errors. 工作池名称
+	silent             bool                               // skip all logging. 静默模式
+	exponentialBackoff bool                               // double the retry backoff after each attempt. 重试间隔指数增长
+	rateLimit          int                                // max tasks started per second. 每秒最多启动的任务数
+	rateTicker         *time.Ticker                       // paces task starts when rateLimit is set. 限速
+	idleTimeout        time.Duration                      // idle workers exit after this long. 空闲worker的退出时间
+	ringSize           int                                // initial size of the ring buffer queue, 0 uses the heap. 环形缓冲队列大小
+	stagger            time.Duration                      // spread the first tasks of the workers started within this after start. 启动错开时间
+	startedAt          time.Time                          // when the pool started, set by start. 启动时间
+	clock              Clock                              // source of time for timeouts and deadlines. 超时与截止时间使用的时钟
+	recycleAfter       int                                // replace a worker after this many tasks. worker执行多少个任务后替换
+	nilTaskPolicy      NilTaskPolicy                      // how nil tasks are handled. 空任务处理方式
+	panicPolicy        PanicPolicy                        // how task panics are handled. panic 处理方式
+	errBuffer          int                                // buffer of the Errors stream. 错误流缓冲大小
+	errOverflow        ErrorOverflow                      // Errors stream policy once the buffer is full. 错误流已满时的策略
+	resultBuffer       int                                // buffer of the Results stream of a typed pool. 结果流缓冲大小
+	resultOverflow     ResultOverflow                     // Results stream policy once the buffer is full. 结果流已满时的策略
+	semaphore          bool                               // run each task in its own goroutine, bounded by sem. 信号量模式
+	unbounded          bool                               // New(max <= 0), one goroutine per task without limit. 不限并发
+	fifo               bool                               // start tasks in submission order. 按提交顺序开始执行
+	keyedRouting       bool                               // DoKeyed tasks go to the worker of their key. 按 key 路由到固定worker
+	slowThreshold      time.Duration                      // report tasks running longer than this. 慢任务阈值
+	deadlockAfter      time.Duration                      // dump the stacks once stuck this long, 0 is off. 死锁检测阈值
+	onSlow             SlowTaskHandler                    // slow task callback. 慢任务回调
+	slow               *slowTasks                         // running tasks, nil unless the watchdog is on. 执行中的任务
+	sem                chan struct{}                      // one slot per running task in semaphore mode. 信号量
+	concurrency        int                                // WithConcurrency cap of tasks running at once, 0 means no cap. 并发上限
+	conc               chan struct{}                      // one slot per running task with WithConcurrency. 并发信号量
+	failFast           bool                               // Stop the pool on the first task error, otherwise keep every error. 首个错误时停止，否则收集所有错误
+	mu                 sync.Mutex                         // guards errs, errStream, waiters, stopping, pause and drain state, the callbacks and spawning. 保护共享状态
+	errs               []error                            // collected errors. 收集的错误
+	errStream          chan error                         // streams task errors, nil unless Errors was called. 错误流
+	events             chan Event                         // lifecycle events, nil unless Events was called. 事件流
+	eventsClosed       bool                               // Wait closed the event stream. 事件流已关闭
+	stopping           bool                               // Wait closed the task chan. 已关闭任务通道
+	drainCh            chan struct{}                      // closed once no task is outstanding, nil unless Drain waits. 等待 Drain
+	epoch              atomic.Pointer[epoch]              // tasks submitted since the last barrier. 上次屏障之后提交的任务
+	barrier            chan struct{}                      // closed by the last barrier, guarded by mu. 最近一次屏障
+	firstErr           error                              // first task error since the pool started. 首个任务错误
+	finalStats         Stats                              // Stats once the last Wait finished, guarded by mu. 结束时的统计
+	succeeded          chan struct{}                      // closed once a task finished without error. 首个任务成功时关闭
+	crashed            string                             // first task panic with PanicCrash, raised again by Wait, guarded by mu. 待 Wait 重新抛出的 panic
+	waiters            []waiterN                          // WaitN calls. 等待 n 个任务的调用
+	nWaiters           int32                              // len(waiters), read atomically on the hot path. 等待者数量
+	hasEvents          int32                              // Events was called, read atomically on the hot path. 已开启事件流
+	wg                 sync.WaitGroup
+	bg                 sync.WaitGroup // dispatcher goroutine. 分发协程
+	task               chan *job
+	capacity           int // pending tasks before the pool counts as saturated. 饱和阈值
+	whenFull           int // fullGrow, fullBlock or fullError. 队列已满时的行为
+	waitingQueue       *taskQueue
+	parent             context.Context // context given to NewWithContext. 父上下文
+	ctx                context.Context // derived from the parent context, cancelling it tears down the pool. 上下文取消时关闭工作池
+	cancel             context.CancelFunc
+	done               chan struct{} // closed when Wait returns. 等待结束时关闭
+	waitOnce           *sync.Once    // runs the shutdown once. 只执行一次停止流程
+	waitErr            error         // result of the first Wait. 首次等待的结果
+	quit               chan struct{} // wakes up idle workers on shrink. 缩容时唤醒空闲worker
+	lanes              []chan *job   // worker queues of WithKeyedRouting, nil otherwise. 按 key 路由的worker队列
+	laneUp             []bool        // the worker of the lane started, only used by the dispatcher. 队列的worker已启动
+	idled              chan struct{} // wakes up the dispatcher once an idle worker exited or on Resize. 空闲worker退出或调整数量时唤醒分发协程
+	released           chan struct{} // wakes up the dispatcher waiting for worker slots. 唤醒等待名额的分发协程
+	pauseCh            chan struct{} // closed on Pause. 暂停时关闭
+	resumeCh           chan struct{} // closed on Resume, nil unless paused. 恢复时关闭
 }
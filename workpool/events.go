@@ -0,0 +1,85 @@
+package workpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventType Kind of a pool lifecycle event
+type EventType int
+
+const (
+	// TaskSubmitted a task was queued. 任务已提交
+	TaskSubmitted EventType = iota + 1
+	// TaskStarted a worker started the task. 任务开始执行
+	TaskStarted
+	// TaskCompleted the task finished without error. 任务成功
+	TaskCompleted
+	// TaskFailed the task finished with an error. 任务失败
+	TaskFailed
+	// TaskTimedOut the task exceeded its timeout or deadline. 任务超时
+	TaskTimedOut
+	// WorkerStarted a worker goroutine started. worker启动
+	WorkerStarted
+	// WorkerStopped a worker goroutine stopped. worker退出
+	WorkerStopped
+)
+
+// eventBuffer Number of events kept for a slow reader before new events are dropped
+const eventBuffer = 1024
+
+// Event One pool lifecycle event
+type Event struct {
+	Type     EventType
+	Pool     string // WithName name of the pool. 工作池名称
+	Time     time.Time
+	TaskID   string // DoWithID id, empty if none. 任务标识
+	WorkerID int    // set for WorkerStarted and WorkerStopped. worker编号
+	Err      error  // set for TaskFailed and TaskTimedOut. 任务错误
+}
+
+// Events Stream the lifecycle events of the pool, the channel is closed when Wait returns
+// Call it before submitting, events are buffered and dropped once a slow reader lets the buffer fill up,
+// so workers never wait for the reader, pools that never call it pay nothing
+func (p *WorkPool) Events() <-chan Event { // 实时获取工作池事件，Wait 结束时关闭，读取过慢时丢弃
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.events == nil {
+		p.events = make(chan Event, eventBuffer)
+		if p.eventsClosed { // Wait already returned. 已结束
+			close(p.events)
+		}
+		atomic.StoreInt32(&p.hasEvents, 1)
+	}
+	return p.events
+}
+
+// emit Send an event without blocking, no-op unless Events was called
+func (p *WorkPool) emit(typ EventType, j *job, workerID int, err error) {
+	if atomic.LoadInt32(&p.hasEvents) == 0 {
+		return
+	}
+	e := Event{Type: typ, Pool: p.name, Time: time.Now(), WorkerID: workerID, Err: err}
+	if j != nil {
+		e.TaskID = j.id
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.eventsClosed {
+		return
+	}
+	select {
+	case p.events <- e:
+	default: // the reader is too slow. 读取过慢，丢弃
+	}
+}
+
+// closeEvents Close the event stream once no event can happen anymore
+func (p *WorkPool) closeEvents() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eventsClosed = true
+	if p.events != nil {
+		close(p.events)
+	}
+}
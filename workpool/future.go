@@ -0,0 +1,74 @@
+package workpool
+
+import (
+	"sync/atomic"
+)
+
+const (
+	futurePending   int32 = iota // waiting in the queue. 排队中
+	futureRunning                // picked up by a worker. 执行中
+	futureAbandoned              // the pool stopped before it ran. 工作池已停止，未执行
+)
+
+// Future result of a task submitted by DoResult
+type Future struct {
+	state int32
+	done  chan struct{}
+	value interface{}
+	err   error
+	pool  *WorkPool
+}
+
+// DoResult Add to the workpool and return a future for the task result
+func (p *WorkPool) DoResult(fn func() (interface{}, error)) *Future { // 添加到工作池，返回获取结果的 Future
+	f := &Future{
+		done: make(chan struct{}),
+		pool: p,
+	}
+	if p.IsClosed() { // closed
+		f.abandon(ErrPoolClosed)
+		return f
+	}
+
+	err := p.Do(func() error {
+		if !atomic.CompareAndSwapInt32(&f.state, futurePending, futureRunning) {
+			return nil // abandoned. 已放弃
+		}
+		defer close(f.done)
+		f.err = p.safeRun(func() error {
+			var err error
+			f.value, err = fn()
+			return err
+		})
+		return f.err
+	})
+	if err != nil { // not accepted, e.g. closed or ErrQueueFull. 未被接受
+		f.abandon(err)
+	}
+	return f
+}
+
+// SubmitWaitResult Add to the workpool, wait for the task to run on a worker and return its value and error
+func (p *WorkPool) SubmitWaitResult(fn func() (interface{}, error)) (interface{}, error) { // 添加到工作池，等待执行完成并返回结果
+	return p.DoResult(fn).Get()
+}
+
+// Get Block until the task completes and return its value and error
+// It is safe to call multiple times from multiple goroutines
+func (f *Future) Get() (interface{}, error) { // 阻塞等待任务结束，返回结果（可多次调用）
+	select {
+	case <-f.done:
+	case <-f.pool.ctx.Done(): // the task may never run. 任务可能不再执行
+		f.abandon(ErrPoolClosed)
+		<-f.done
+	}
+	return f.value, f.err
+}
+
+// abandon Finish a future whose task will never run with err
+func (f *Future) abandon(err error) {
+	if atomic.CompareAndSwapInt32(&f.state, futurePending, futureAbandoned) {
+		f.err = err
+		close(f.done)
+	}
+}
@@ -0,0 +1,79 @@
+package workpool
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// laneBuffer tasks waiting in the queue of a keyed worker, more go to any worker
+const laneBuffer = 1
+
+// maxLanes cap on the keyed workers, so a huge max does not allocate a queue per worker
+const maxLanes = 1024
+
+// DoKeyed Add to the workpool, tasks with the same key run on the same worker with WithKeyedRouting
+// Once that worker is busy and already has a task waiting, the task runs on any worker instead of waiting for it,
+// so a hot key does not starve the others. Without WithKeyedRouting it is the same as Do
+func (p *WorkPool) DoKeyed(key string, fn TaskHandler) error { // 添加到工作池，相同 key 的任务交给同一个worker执行
+	return p.push(&job{fn: fn.withContext(), handler: fn, key: key, keyed: true})
+}
+
+// startLanes Make one worker queue per worker slot up to maxLanes, the workers start on first use
+func (p *WorkPool) startLanes() {
+	p.lanes, p.laneUp = nil, nil
+	if !p.keyedRouting || p.unbounded || p.sem != nil {
+		return
+	}
+	n := atomic.LoadInt32(&p.maxWorkers)
+	if n > maxLanes {
+		n = maxLanes
+	}
+	p.lanes = make([]chan *job, n)
+	for i := range p.lanes {
+		p.lanes[i] = make(chan *job, laneBuffer)
+	}
+	p.laneUp = make([]bool, n)
+}
+
+// toLane Hand a DoKeyed job to the worker of its key, false if that worker is backed up or the pool is stopping
+// Only called by the dispatcher
+func (p *WorkPool) toLane(j *job) bool { // 交给 key 对应的worker，该worker积压时返回false
+	h := fnv.New32a()
+	h.Write([]byte(j.key))
+	i := int(h.Sum32() % uint32(len(p.lanes)))
+	if !p.laneUp[i] {
+		p.mu.Lock()
+		if p.stopping {
+			p.mu.Unlock()
+			return false
+		}
+		p.wg.Add(1)
+		p.mu.Unlock()
+		p.laneUp[i] = true
+		go p.laneWorker(p.lanes[i])
+	}
+	select {
+	case p.lanes[i] <- j:
+		return true
+	default: // any worker takes it. 交给任意worker
+		return false
+	}
+}
+
+// laneWorker Run the tasks of one worker queue until the pool stops
+// The dispatcher acquired their worker slots, so it does not count in the workers
+func (p *WorkPool) laneWorker(lane chan *job) { // 执行某个 key 队列的任务
+	defer p.wg.Done()
+	ctx, stop := p.workerStarted()
+	defer stop()
+	for j := range lane {
+		p.execute(ctx, j)
+	}
+}
+
+// closeLanes Stop the keyed workers once the dispatcher exited
+func (p *WorkPool) closeLanes() {
+	for _, lane := range p.lanes {
+		close(lane)
+	}
+}
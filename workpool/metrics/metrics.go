@@ -0,0 +1,83 @@
+// Package metrics exports workpool runtime counters to Prometheus
+// It lives in its own package so the workpool package does not depend on Prometheus
+package metrics
+
+import (
+	"time"
+
+	"github.com/mattlaibybit/gowp/workpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register Register the metrics of p on reg, labeled with pool=name
+// The task duration histogram is fed through AddOnComplete, so a hook already set keeps running,
+// on error none of the metrics stays registered
+func Register(reg prometheus.Registerer, name string, p *workpool.WorkPool) error { // 注册工作池的 Prometheus 指标
+	labels := prometheus.Labels{"pool": name}
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace:   "workpool",
+		Name:        "task_duration_seconds",
+		Help:        "Duration of the tasks run by the workpool.",
+		ConstLabels: labels,
+		Buckets:     prometheus.DefBuckets,
+	})
+
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "workpool",
+			Name:        "queued_tasks",
+			Help:        "Tasks waiting for a worker.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Pending()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "workpool",
+			Name:        "running_tasks",
+			Help:        "Tasks being executed.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Running()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "workpool",
+			Name:        "workers",
+			Help:        "Worker goroutines currently started.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Stats().Workers) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "workpool",
+			Name:        "completed_tasks_total",
+			Help:        "Tasks finished without error.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Stats().Completed) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "workpool",
+			Name:        "failed_tasks_total",
+			Help:        "Tasks finished with an error.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Stats().Failed) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "workpool",
+			Name:        "panicked_tasks_total",
+			Help:        "Recovered task panics.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Stats().Panics) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "workpool",
+			Name:        "timed_out_tasks_total",
+			Help:        "Tasks that exceeded their timeout or deadline.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Stats().Timeouts) }),
+		duration,
+	}
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			for _, done := range collectors[:i] { // all or nothing. 全部注册或全部不注册
+				reg.Unregister(done)
+			}
+			return err
+		}
+	}
+
+	p.AddOnComplete(func(d time.Duration, err error) {
+		duration.Observe(d.Seconds())
+	})
+	return nil
+}
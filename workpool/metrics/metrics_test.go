@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattlaibybit/gowp/workpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Export the pool counters
+func TestRegister(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	wp := workpool.New(5, workpool.WithCollectErrors()) // Set the maximum number of threads
+	if err := Register(reg, "test", wp); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii%5 == 0 {
+				return errors.New("my test err")
+			}
+			return nil
+		})
+	}
+	wp.Wait()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range families {
+		m := mf.GetMetric()[0]
+		switch {
+		case m.GetCounter() != nil:
+			got[mf.GetName()] = m.GetCounter().GetValue()
+		case m.GetHistogram() != nil:
+			got[mf.GetName()] = float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+	fmt.Println(got)
+	if got["workpool_completed_tasks_total"] != 8 || got["workpool_failed_tasks_total"] != 2 ||
+		got["workpool_task_duration_seconds"] != 10 {
+		t.Errorf("metrics = %v", got)
+	}
+	fmt.Println("down")
+}
+
+// Keep the OnComplete hook already set and register all the metrics or none
+func TestRegisterKeepsHook(t *testing.T) {
+	var calls int
+	wp := workpool.New(1, workpool.WithOnComplete(func(time.Duration, error) { calls++ })) // Set the maximum number of threads
+	reg := prometheus.NewRegistry()
+	if err := Register(reg, "test", wp); err != nil {
+		t.Fatal(err)
+	}
+	wp.Do(func() error { return nil })
+	wp.Wait()
+	if calls != 1 {
+		t.Errorf("hook called %v times, want 1", calls)
+	}
+
+	// the same pool name twice, nothing of the second one stays. 重名注册失败后不残留
+	reg = prometheus.NewRegistry()
+	taken := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   "workpool",
+		Name:        "timed_out_tasks_total",
+		Help:        "Tasks that exceeded their timeout or deadline.",
+		ConstLabels: prometheus.Labels{"pool": "test"},
+	})
+	reg.MustRegister(taken)
+	if err := Register(reg, "test", wp); err == nil {
+		t.Fatal("Register() = nil, want the conflict")
+	}
+	reg.Unregister(taken)
+	if err := Register(reg, "test", wp); err != nil {
+		t.Errorf("Register() after a failed one = %v, want nil", err)
+	}
+	fmt.Println("down")
+}
@@ -0,0 +1,51 @@
+package workpool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// multiErrorShown number of messages listed by MultiError.Error
+const multiErrorShown = 3
+
+// MultiError every task error returned by Wait without fail-fast, supports errors.Is and errors.As
+type MultiError struct {
+	errs []error
+}
+
+// newMultiError Wrap errs, nil if there is none
+func newMultiError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &MultiError{errs: errs}
+}
+
+// Error Count and first few messages, the message of the error alone if there is only one
+func (e *MultiError) Error() string { // 错误数量及前几个错误信息
+	if len(e.errs) == 1 {
+		return e.errs[0].Error()
+	}
+	msgs := make([]string, 0, multiErrorShown)
+	for i, err := range e.errs {
+		if i == multiErrorShown {
+			break
+		}
+		msgs = append(msgs, err.Error())
+	}
+	s := fmt.Sprintf("%d errors: %s", len(e.errs), strings.Join(msgs, "; "))
+	if more := len(e.errs) - multiErrorShown; more > 0 {
+		s += fmt.Sprintf("; and %d more", more)
+	}
+	return s
+}
+
+// Errors Every error in the order they were reported
+func (e *MultiError) Errors() []error { // 全部错误
+	return append([]error(nil), e.errs...)
+}
+
+// Unwrap The errors for errors.Is and errors.As
+func (e *MultiError) Unwrap() []error {
+	return e.errs
+}
@@ -0,0 +1,306 @@
+package workpool
+
+import (
+	"context"
+	"time"
+)
+
+// Option workpool option
+type Option interface {
+	apply(*WorkPool)
+}
+
+type optionFunc func(*WorkPool)
+
+func (f optionFunc) apply(p *WorkPool) {
+	f(p)
+}
+
+// WithContext 绑定上下文，上下文取消时关闭整个工作池，Wait 返回 ctx.Err()，效果同 NewWithContext
+func WithContext(ctx context.Context) Option {
+	return optionFunc(func(p *WorkPool) {
+		if ctx != nil {
+			p.parent = ctx
+		}
+	})
+}
+
+// WithTimeout 设置每个任务的超时时间，在启动worker之前生效
+func WithTimeout(timeout time.Duration) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.timeout = int64(timeout)
+	})
+}
+
+// WithPanicHandler 设置任务 panic 时的回调，panic 按 WithPanicPolicy 处理，默认作为任务错误返回
+func WithPanicHandler(fn PanicHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.panicHandler = fn
+	})
+}
+
+// WithPanicPolicy 设置任务 panic 的处理方式: PanicAsError 转换为任务错误(默认)，PanicIgnore 忽略并视为成功，
+// PanicCrash 停止工作池并在 Wait 中重新 panic (适合测试)，WithPanicHandler 的回调在三种方式下都会执行
+func WithPanicPolicy(policy PanicPolicy) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.panicPolicy = policy
+	})
+}
+
+// WithErrorHandler 设置任务出错或超时时的回调，在日志之外调用，不影响 Wait 的返回值
+func WithErrorHandler(fn ErrorHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.errorHandler = fn
+	})
+}
+
+// WithOnWorkerStart 设置每个worker协程启动时的回调(如创建worker独占的连接)，参数为worker编号，
+// 编号在worker存活期间不变，信号量与不限并发模式下每个任务协程视为一个worker
+func WithOnWorkerStart(fn WorkerHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.onWorkerStart = fn
+	})
+}
+
+// WithOnWorkerStop 设置每个worker协程退出时的回调，参数与 WithOnWorkerStart 相同，Wait 返回前均已执行
+func WithOnWorkerStop(fn WorkerHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.onWorkerStop = fn
+	})
+}
+
+// WithWorkerValue 为每个worker协程创建独占的值(如数据库连接、缓冲区): worker启动时调用 open(worker编号)，
+// 退出时调用 close(该值)(可为nil)，该worker执行的任务通过 WorkPool.WorkerValue(ctx) 获取，需使用 DoContext 等带上下文的任务
+func WithWorkerValue(open func(workerID int) interface{}, close func(v interface{})) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.openWorkerValue, p.closeWorkerValue = open, close
+	})
+}
+
+// WithOnComplete 设置任务结束后的回调，参数为耗时与错误，在worker上执行，不计入超时
+func WithOnComplete(fn CompleteHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.onComplete = fn
+	})
+}
+
+// WithDeadLetter 任务返回错误(包括 panic 与超时)后在worker上调用 fn(原任务, 错误)，可收集后重新提交或人工处理，
+// 不影响 Wait、Errors 等的错误上报，只包含以 TaskHandler 提交的任务，带上下文或等待结果的任务(DoContext、DoWait 等)不会传入
+func WithDeadLetter(fn DeadLetterHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.deadLetter = fn
+	})
+}
+
+// WithQueueSize 设置排队任务数达到多少时 TrySubmit 视为已满，默认 2*max，与worker数无关(等待队列本身不限长度)，
+// n == 0 为同步交接: 只有存在空闲worker时 TrySubmit 才接受任务，n < 0 时忽略
+func WithQueueSize(n int) Option {
+	return optionFunc(func(p *WorkPool) {
+		if n >= 0 {
+			p.capacity = n
+		}
+	})
+}
+
+// WithBlockWhenFull 队列达到 WithQueueSize 时的提交行为: true 阻塞等待空位，false 立即返回 ErrQueueFull，
+// 默认不设置时队列不限长度，阻塞模式下任务内部用 Do 再提交任务可能死锁，应使用 Resubmit
+func WithBlockWhenFull(block bool) Option {
+	return optionFunc(func(p *WorkPool) {
+		if block {
+			p.whenFull = fullBlock
+		} else {
+			p.whenFull = fullError
+		}
+	})
+}
+
+// WithRecycleAfter 每个worker执行 n 个任务后退出并由新的worker替换，n <= 0 不替换
+func WithRecycleAfter(n int) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.recycleAfter = n
+	})
+}
+
+// WithNilTaskPolicy 设置空任务的处理方式: NilTaskSkip 忽略(默认)，NilTaskError 记为 ErrNilTask 错误，NilTaskPanic 提交时 panic
+func WithNilTaskPolicy(policy NilTaskPolicy) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.nilTaskPolicy = policy
+	})
+}
+
+// WithErrorBuffer 设置 Errors 错误流的缓冲大小，默认 0 (无缓冲)
+func WithErrorBuffer(n int) Option {
+	return optionFunc(func(p *WorkPool) {
+		if n >= 0 {
+			p.errBuffer = n
+		}
+	})
+}
+
+// WithErrorOverflow 设置 Errors 错误流缓冲已满时的处理方式: ErrorBlock 任务等待读取(默认)，ErrorDropNewest 丢弃新的错误，
+// ErrorDropOldest 丢弃最旧的错误(无缓冲时同 ErrorDropNewest)，只影响错误流，Wait 的返回值不受影响
+func WithErrorOverflow(policy ErrorOverflow) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.errOverflow = policy
+	})
+}
+
+// WithResultBuffer 设置带返回值工作池 Results 结果流的缓冲大小，默认 0 (无缓冲)
+func WithResultBuffer(n int) Option {
+	return optionFunc(func(p *WorkPool) {
+		if n >= 0 {
+			p.resultBuffer = n
+		}
+	})
+}
+
+// WithResultOverflow 设置 Results 结果流缓冲已满时的处理方式: ResultBlock 任务等待读取(默认)，ResultDropNewest 丢弃新的结果，
+// ResultDropOldest 丢弃最旧的结果(无缓冲时同 ResultDropNewest)，只影响结果流，Wait 返回的结果不受影响
+func WithResultOverflow(policy ResultOverflow) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.resultOverflow = policy
+	})
+}
+
+// WithFailFast 设置是否快速失败，默认开启: 首个任务出错时关闭工作池并丢弃剩余任务，
+// 关闭后出错不停止工作池，所有任务的错误被收集并由 Wait 一并返回
+func WithFailFast(failFast bool) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.failFast = failFast
+	})
+}
+
+// WithCollectErrors 收集所有任务的错误，出错时不关闭工作池，等同 WithFailFast(false)
+func WithCollectErrors() Option {
+	return WithFailFast(false)
+}
+
+// WithContinueOnError 任务出错时继续执行剩余任务，错误被收集并由 Wait 一并返回，等同 WithFailFast(false)
+func WithContinueOnError() Option {
+	return WithCollectErrors()
+}
+
+// WithName 设置工作池名称，日志中的错误与超时以 "workpool <name>: " 开头，并出现在 Stats 与 Events 中，
+// 便于区分多个工作池
+func WithName(name string) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.name = name
+	})
+}
+
+// WithLogger 设置错误日志，默认不记录
+func WithLogger(logger Logger) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.logger = logger
+	})
+}
+
+// WithSilent 静默模式，不记录任何日志，错误仍由 Wait 返回
+func WithSilent() Option {
+	return optionFunc(func(p *WorkPool) {
+		p.silent = true
+	})
+}
+
+// WithExponentialBackoff DoRetry 每次重试后等待时间加倍
+func WithExponentialBackoff() Option {
+	return optionFunc(func(p *WorkPool) {
+		p.exponentialBackoff = true
+	})
+}
+
+// WithRateLimit 限制每秒最多启动 rps 个任务，与并发数限制相互独立
+func WithRateLimit(rps int) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.rateLimit = rps
+	})
+}
+
+// WithStartupStagger 工作池启动后 d 时间内启动的worker，在执行首个任务前随机等待 [0, d)，
+// 避免大量worker同时访问共享资源，之后启动的worker不受影响，默认关闭，信号量模式与不限并发时无效
+func WithStartupStagger(d time.Duration) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.stagger = d
+	})
+}
+
+// WithRingBuffer 等待队列使用初始容量为 size 的环形缓冲(已满时自动扩容)代替默认的优先级堆，
+// 减少大量小任务的开销，任务严格按提交顺序分发，DoPriority 的优先级被忽略，size <= 0 时使用默认的堆
+func WithRingBuffer(size int) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.ringSize = size
+	})
+}
+
+// WithKeyedRouting DoKeyed 按 key 的哈希把任务交给固定的worker(每个worker一个队列，数量为启动时的worker数且最多1024个，首次使用时启动)，
+// 提高依赖本地缓存的任务的命中率，该worker忙且已有任务等待时交给任意worker，信号量模式与不限并发时无效
+func WithKeyedRouting() Option {
+	return optionFunc(func(p *WorkPool) {
+		p.keyedRouting = true
+	})
+}
+
+// WithClock 任务超时、截止时间、DoRetry 的重试间隔以及 DoWaitTimeout、TryDoWait、WaitTimeout 使用的时钟，
+// 默认为系统时钟，测试中可注入假时钟以推进时间而无需真实等待，nil 时忽略
+func WithClock(c Clock) Option {
+	return optionFunc(func(p *WorkPool) {
+		if c != nil {
+			p.clock = c
+		}
+	})
+}
+
+// WithTimerWheel 任务超时、截止时间与带超时的等待共用一个按 tick 推进的时间轮，代替每个任务各自的系统定时器，
+// 适合大量带超时的短任务，超时时间按 tick 向上取整、最多晚一个 tick 触发，取消语义不变，tick <= 0 时为 1ms，会替换 WithClock
+func WithTimerWheel(tick time.Duration) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.clock = newTimerWheel(tick)
+	})
+}
+
+// WithConcurrency 同时执行的任务最多 n 个，与worker数量无关: 多余的worker持有任务等待空位，
+// 适合保留较多worker但限制访问下游资源的并发，等待时间不计入超时，n <= 0 (默认) 时等于worker数量
+func WithConcurrency(n int) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.concurrency = n
+	})
+}
+
+// WithIdleTimeout 空闲超过 d 的worker退出，没有任务时缩减到零个worker，有新任务时再按需启动，最多 max 个
+func WithIdleTimeout(d time.Duration) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.idleTimeout = d
+	})
+}
+
+// WithFIFO 任务严格按提交顺序开始执行: 分发协程等待上一个任务开始后才交出下一个，略微降低吞吐，
+// 默认只保证按顺序交给worker，开始执行的先后不确定
+func WithFIFO() Option {
+	return optionFunc(func(p *WorkPool) {
+		p.fifo = true
+	})
+}
+
+// WithSlowTaskThreshold 每隔 d 检查执行中的任务，执行超过 d 的任务调用 fn(任务标识, 已执行时长)，只告警不取消，
+// 任务仍在执行时每次检查都会再次回调，任务标识由 DoWithID 设置，d <= 0 或 fn 为 nil 时不检查
+func WithSlowTaskThreshold(d time.Duration, fn SlowTaskHandler) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.slowThreshold, p.onSlow = d, fn
+	})
+}
+
+// WithDeadlockDetector 调试用，默认关闭: 所有worker都被占用、有任务排队且 d 内没有任务结束时，
+// 将全部协程栈输出到日志(未设置日志时输出到 stderr)，每次停滞只输出一次，d <= 0 时不检测
+func WithDeadlockDetector(d time.Duration) Option {
+	return optionFunc(func(p *WorkPool) {
+		p.deadlockAfter = d
+	})
+}
+
+// WithSemaphore 信号量模式: 不常驻worker，每个任务占用一个空位(最多 max 个)在独立协程中执行，
+// 适合 max 很大但任务稀疏的场景，该模式下 Resize 无效
+func WithSemaphore() Option {
+	return optionFunc(func(p *WorkPool) {
+		p.semaphore = true
+	})
+}
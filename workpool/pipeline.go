@@ -0,0 +1,58 @@
+package workpool
+
+// Pipeline two typed pools chained, every result of the first stage is fed to the second one
+type Pipeline[T, R any] struct {
+	up         *Pool[T]
+	down       *Pool[R]
+	done       chan struct{} // closed once every upstream result was forwarded. 转发结束
+	upCanceled bool          // the downstream failure canceled the upstream. 因下游失败取消了上游
+}
+
+// NewPipeline Connect the results of up to down, f turns each value into the downstream task
+// Each stage keeps its own concurrency, failed upstream tasks are not forwarded
+// Call it before submitting to up, only results completing afterwards are forwarded
+func NewPipeline[T, R any](up *Pool[T], down *Pool[R], f func(T) (R, error)) *Pipeline[T, R] { // 串联两个工作池，上游结果交给下游处理
+	pl := &Pipeline[T, R]{up: up, down: down, done: make(chan struct{})}
+	results := up.Results()
+	stopped := down.wp.ctx.Done()
+	go func() {
+		defer close(pl.done)
+		for r := range results {
+			if r.Err != nil || pl.upCanceled {
+				continue
+			}
+			select {
+			case <-stopped: // downstream failed, stop the upstream. 下游已停止，取消上游
+				pl.upCanceled = true
+				up.wp.Cancel()
+				continue
+			default:
+			}
+			v := r.Value
+			down.Submit(func() (R, error) {
+				return f(v)
+			})
+		}
+	}()
+	return pl
+}
+
+// Submit Add a task to the first stage, returns the error of the upstream Submit
+func (pl *Pipeline[T, R]) Submit(fn func() (T, error)) error { // 添加任务到上游
+	return pl.up.Submit(fn)
+}
+
+// Wait Wait for both stages and return the downstream results in the order they were forwarded
+// An upstream failure cancels the downstream in fail-fast mode, the first failing stage's error is returned
+func (pl *Pipeline[T, R]) Wait() ([]R, error) { // 等待两个阶段结束，返回下游结果与首个失败阶段的错误
+	_, upErr := pl.up.Wait()
+	<-pl.done
+	if upErr != nil && !pl.upCanceled && pl.up.wp.failFast {
+		pl.down.wp.Cancel()
+	}
+	results, downErr := pl.down.Wait()
+	if upErr != nil && !pl.upCanceled {
+		return results, upErr
+	}
+	return results, downErr
+}
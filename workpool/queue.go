@@ -0,0 +1,292 @@
+package workpool
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// taskQueue Waiting queue of jobs, higher priority first and FIFO within a priority
+type taskQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    jobHeap
+	ring     *jobRing // FIFO store replacing items, nil unless WithRingBuffer. 环形缓冲
+	seq      uint64
+	count    int32
+	closed   bool
+	sealed   bool       // Push is refused, queued jobs still run. 拒绝插入，已排队的任务继续执行
+	dropped  func(*job) // called for every job discarded by Close. 丢弃任务的回调
+}
+
+func newTaskQueue(ringSize int, dropped func(*job)) *taskQueue {
+	q := &taskQueue{dropped: dropped}
+	if ringSize > 0 {
+		q.ring = newJobRing(ringSize)
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push Add a job, return false if the queue is closed or sealed (non-blocking)
+func (q *taskQueue) Push(j *job) bool { // 插入队列，非阻塞
+	return q.push(j, false)
+}
+
+// PushSealed Add a job even once sealed, return false if the queue is closed (non-blocking)
+func (q *taskQueue) PushSealed(j *job) bool { // 插入队列，已封闭时仍可插入
+	return q.push(j, true)
+}
+
+func (q *taskQueue) push(j *job, sealedOK bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || (q.sealed && !sealedOK) {
+		return false
+	}
+
+	q.add(j)
+	atomic.AddInt32(&q.count, 1)
+	q.notEmpty.Signal()
+	return true
+}
+
+// PushWait Add a job, block while limit jobs are queued, return false if the queue is closed
+// or stop is closed first, a nil stop waits forever. The onWait of the job is called once before blocking, unlocked
+func (q *taskQueue) PushWait(j *job, limit int, stop <-chan struct{}) bool { // 插入队列，队列已满时阻塞
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.length() >= limit && stop != nil { // wake up on stop. 停止时唤醒
+		waiting := make(chan struct{})
+		defer close(waiting)
+		go func() {
+			select {
+			case <-stop:
+				q.mu.Lock()
+				q.notFull.Broadcast()
+				q.mu.Unlock()
+			case <-waiting:
+			}
+		}()
+	}
+	onWait := j.onWait
+	for q.length() >= limit && !q.closed && !q.sealed && !isClosed(stop) {
+		if onWait != nil { // DoAdmit
+			q.mu.Unlock()
+			onWait()
+			onWait = nil
+			q.mu.Lock()
+			continue
+		}
+		q.notFull.Wait()
+	}
+	if q.closed || q.sealed || q.length() >= limit {
+		return false
+	}
+
+	q.add(j)
+	atomic.AddInt32(&q.count, 1)
+	q.notEmpty.Signal()
+	return true
+}
+
+// Pop Take the next job, block until one is available, nil once closed
+func (q *taskQueue) Pop() *job { // 取出队列（阻塞模式），关闭后返回nil
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.length() == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.closed {
+		return nil
+	}
+
+	j := q.next()
+	atomic.AddInt32(&q.count, -1)
+	q.notFull.Signal()
+	return j
+}
+
+// Len Number of queued jobs
+func (q *taskQueue) Len() int { // 获取队列长度
+	return int(atomic.LoadInt32(&q.count))
+}
+
+// Close Discard the queued jobs, Pop returns nil and Push is refused afterwards
+func (q *taskQueue) Close() { // 关闭队列，丢弃排队的任务
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	jobs := q.clear()
+	atomic.StoreInt32(&q.count, 0)
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	for _, j := range jobs { // outside the lock. 不持锁
+		j.abandon()
+		if q.dropped != nil {
+			q.dropped(j)
+		}
+	}
+}
+
+// Jobs Queued jobs in dispatch order, the queue is unchanged
+func (q *taskQueue) Jobs() []*job { // 排队的任务，不取出
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ring != nil {
+		jobs := q.ring.clear()
+		for _, j := range jobs { // put them back in the same order. 按原顺序放回
+			q.ring.push(j)
+		}
+		return jobs
+	}
+	jobs := append(jobHeap(nil), q.items...)
+	sort.Sort(jobs)
+	return jobs
+}
+
+// Take Remove every queued job and return them in dispatch order, the queue stays open
+func (q *taskQueue) Take() []*job { // 取出全部排队的任务
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := q.clear()
+	if q.ring == nil {
+		sort.Sort(jobHeap(jobs))
+	}
+	atomic.StoreInt32(&q.count, 0)
+	q.notFull.Broadcast()
+	return jobs
+}
+
+// Seal Refuse any further Push, the queued jobs still run and PushSealed is still accepted
+func (q *taskQueue) Seal() { // 拒绝新任务，已排队的任务继续执行
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sealed = true
+	q.notFull.Broadcast() // blocked pushes give up. 阻塞的插入放弃
+}
+
+// IsClosed Whether the queue refuses Push, closed or sealed
+func (q *taskQueue) IsClosed() bool { // 队列是否已关闭
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed || q.sealed
+}
+
+// isClosed Whether ch is closed, false for a nil ch
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// length Number of stored jobs, must hold mu
+func (q *taskQueue) length() int {
+	if q.ring != nil {
+		return q.ring.size
+	}
+	return len(q.items)
+}
+
+// add Store a job, must hold mu
+func (q *taskQueue) add(j *job) {
+	if q.ring != nil {
+		q.ring.push(j)
+		return
+	}
+	q.seq++
+	j.seq = q.seq
+	heap.Push(&q.items, j)
+}
+
+// next Take the next stored job, must hold mu and have one
+func (q *taskQueue) next() *job {
+	if q.ring != nil {
+		return q.ring.pop()
+	}
+	return heap.Pop(&q.items).(*job)
+}
+
+// clear Remove and return every stored job, must hold mu
+func (q *taskQueue) clear() []*job {
+	if q.ring != nil {
+		return q.ring.clear()
+	}
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// jobRing FIFO ring buffer of jobs, doubles once full, priorities are ignored
+type jobRing struct {
+	buf  []*job
+	head int
+	size int
+}
+
+func newJobRing(size int) *jobRing {
+	return &jobRing{buf: make([]*job, size)}
+}
+
+func (r *jobRing) push(j *job) {
+	if r.size == len(r.buf) {
+		buf := make([]*job, 2*len(r.buf))
+		n := copy(buf, r.buf[r.head:])
+		copy(buf[n:], r.buf[:r.head])
+		r.buf, r.head = buf, 0
+	}
+	r.buf[(r.head+r.size)%len(r.buf)] = j
+	r.size++
+}
+
+func (r *jobRing) pop() *job {
+	j := r.buf[r.head]
+	r.buf[r.head] = nil // no reference kept. 释放引用
+	r.head = (r.head + 1) % len(r.buf)
+	r.size--
+	return j
+}
+
+func (r *jobRing) clear() []*job {
+	jobs := make([]*job, 0, r.size)
+	for r.size > 0 {
+		jobs = append(jobs, r.pop())
+	}
+	return jobs
+}
+
+// jobHeap container/heap implementation ordered by priority then submission
+type jobHeap []*job
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x interface{}) { *h = append(*h, x.(*job)) }
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return j
+}
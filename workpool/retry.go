@@ -0,0 +1,95 @@
+package workpool
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy How DoRetryPolicy retries a failing task
+type RetryPolicy struct {
+	MaxAttempts int                  // attempts including the first one, < 1 means 1. 最多执行次数(含首次)
+	BaseDelay   time.Duration        // delay before the first retry, doubled for each further retry. 首次重试前的等待，之后每次翻倍
+	MaxDelay    time.Duration        // upper bound of the delay, 0 means none. 等待上限，0 不限
+	Jitter      float64              // random share of the delay added or removed, 0 to 1. 随机抖动比例
+	RetryIf     func(err error) bool // retry only the errors it accepts, nil retries every error. 只重试返回 true 的错误
+}
+
+// delay Wait before the retry-th retry, starting at 1
+func (rp RetryPolicy) delay(retry int) time.Duration {
+	d := rp.BaseDelay
+	for i := 1; i < retry && (rp.MaxDelay <= 0 || d < rp.MaxDelay); i++ {
+		d *= 2
+	}
+	if rp.Jitter > 0 {
+		j := rp.Jitter
+		if j > 1 {
+			j = 1
+		}
+		d += time.Duration((rand.Float64()*2 - 1) * j * float64(d))
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	return d
+}
+
+// DoRetry Add to the workpool and run the task up to attempts times, waiting backoff between attempts
+// The retries hold the same worker, only the error of the last attempt is reported
+func (p *WorkPool) DoRetry(fn TaskHandler, attempts int, backoff time.Duration) error { // 添加到工作池，失败后重试，最多执行 attempts 次
+	return p.doRetry(fn, attempts, func(retry int) time.Duration {
+		if !p.exponentialBackoff {
+			return backoff
+		}
+		return backoff << (retry - 1)
+	}, nil)
+}
+
+// DoRetryPolicy Add to the workpool and retry the task as set by policy, with exponential backoff and jitter
+// The retries hold the same worker, only the error of the last attempt is reported
+func (p *WorkPool) DoRetryPolicy(fn TaskHandler, policy RetryPolicy) error { // 添加到工作池，按重试策略重试
+	return p.doRetry(fn, policy.MaxAttempts, policy.delay, policy.RetryIf)
+}
+
+// doRetry Add to the workpool a task retried up to attempts times while retryIf accepts its error
+func (p *WorkPool) doRetry(fn TaskHandler, attempts int, delay func(retry int) time.Duration, retryIf func(error) bool) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	j := &job{}
+	if fn != nil {
+		j.fn = func(ctx context.Context) error {
+			var err error
+			for i := 0; i < attempts; i++ {
+				if i > 0 {
+					if retryIf != nil && !retryIf(err) { // permanent error. 不可重试的错误
+						return err
+					}
+					if !p.sleepContext(ctx, delay(i)) { // the pool stopped. 工作池已停止
+						return err
+					}
+				}
+				if err = p.safeRun(fn); err == nil {
+					return nil
+				}
+			}
+			return err
+		}
+	}
+	return p.push(j)
+}
+
+// sleepContext Sleep d on the pool clock, return false if ctx is done first
+func (p *WorkPool) sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-p.clock.After(d):
+		return true
+	}
+}
@@ -0,0 +1,68 @@
+package workpool
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Stats runtime snapshot of the workpool, ready for json.Marshal
+type Stats struct {
+	Name       string        `json:"name,omitempty"` // WithName name of the pool. 工作池名称
+	Queued     int           `json:"queued"`         // tasks waiting for a worker. 排队中的任务数
+	MaxWorkers int           `json:"max_workers"`    // configured number of workers. 设定的worker数
+	Workers    int           `json:"workers"`        // worker goroutines currently started. 已启动的worker数
+	Running    int           `json:"running"`        // tasks being executed. 执行中的任务数
+	Submitted  int64         `json:"submitted"`      // tasks accepted since the pool started. 已提交的任务数
+	Completed  int64         `json:"completed"`      // tasks finished without error. 成功的任务数
+	Failed     int64         `json:"failed"`         // tasks finished with an error, including panics and timeouts. 失败的任务数
+	Panics     int64         `json:"panics"`         // recovered task panics. 任务 panic 次数
+	Timeouts   int64         `json:"timeouts"`       // tasks that exceeded their timeout or deadline. 超时的任务数
+	Paused     bool          `json:"paused"`         // queued tasks are held by Pause. 是否已暂停
+	Closed     bool          `json:"closed"`         // the pool accepts no more tasks. 是否已关闭
+	Elapsed    time.Duration `json:"elapsed"`        // since the pool started, until Wait finished for WaitStats. 启动至今的时长
+}
+
+// Stats Return a snapshot of the runtime counters (non-blocking)
+func (p *WorkPool) Stats() Stats { // 获取运行时统计 (非阻塞)
+	return Stats{
+		Name:       p.name,
+		Queued:     p.Pending(),
+		MaxWorkers: p.MaxWorkers(),
+		Workers:    int(atomic.LoadInt32(&p.workers)),
+		Running:    p.Running(),
+		Submitted:  atomic.LoadInt64(&p.submitted),
+		Completed:  p.CompletedTasks(),
+		Failed:     p.FailedTasks(),
+		Panics:     atomic.LoadInt64(&p.panics),
+		Timeouts:   atomic.LoadInt64(&p.timeouts),
+		Paused:     p.IsPaused(),
+		Closed:     p.IsClosed(),
+		Elapsed:    time.Since(p.startedAt),
+	}
+}
+
+// WaitStats Wait, then return the counters as they were once every task finished, along with the error of Wait
+// The snapshot is taken inside Wait, before the pool can be Reset or the counters read by anyone else
+func (p *WorkPool) WaitStats() (Stats, error) { // 等待结束，返回结束时的统计与错误
+	err := p.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.finalStats, err
+}
+
+// MarshalJSON Encode a Stats snapshot, so the pool can be served as is by a health endpoint
+// Every counter is read once, the encoder never sees a field change halfway
+func (p *WorkPool) MarshalJSON() ([]byte, error) { // 以JSON输出运行时统计
+	return json.Marshal(p.Stats())
+}
+
+// CompletedTasks Number of tasks finished without error since the pool started (non-blocking)
+func (p *WorkPool) CompletedTasks() int64 { // 成功的任务数 (非阻塞)
+	return atomic.LoadInt64(&p.completed)
+}
+
+// FailedTasks Number of tasks finished with an error since the pool started (non-blocking)
+func (p *WorkPool) FailedTasks() int64 { // 失败的任务数 (非阻塞)
+	return atomic.LoadInt64(&p.failed)
+}
@@ -0,0 +1,110 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errTaskCanceled returned to the pool by a task canceled through its handle, counted neither as completed nor failed
+var errTaskCanceled = errors.New("workpool: task canceled")
+
+// Task handle of a task submitted by DoTask
+type Task struct {
+	mu       sync.Mutex
+	done     chan struct{}
+	err      error
+	canceled bool               // Cancel was called. 已调用Cancel
+	finished bool               // done is closed. 已结束
+	cancel   context.CancelFunc // cancels the running task, nil until it started. 取消执行中的任务
+}
+
+// DoTask Add to the workpool and return a handle to cancel the task or wait for it
+func (p *WorkPool) DoTask(fn TaskHandlerCtx) *Task { // 添加到工作池，返回可取消、可等待的任务句柄
+	t := &Task{done: make(chan struct{})}
+	if fn == nil { // nothing to run. 空任务
+		t.finish(nil)
+		return t
+	}
+
+	j := &job{
+		fn: func(ctx context.Context) error {
+			ctx, ok := t.start(ctx)
+			if !ok { // canceled before it started. 开始前已取消
+				return errTaskCanceled
+			}
+			err := fn(ctx)
+			t.finish(err)
+			if t.isCanceled() && errors.Is(err, context.Canceled) { // not a pool failure nor a success. 不计为失败或成功
+				return errTaskCanceled
+			}
+			return err
+		},
+		drop: func() {
+			t.finish(ErrPoolClosed)
+		},
+	}
+	if err := p.push(j); err != nil { // closed
+		t.finish(err)
+	}
+	return t
+}
+
+// Cancel Stop the task, a queued task never runs and a running task has its context canceled
+func (t *Task) Cancel() { // 取消任务: 未开始的不再执行，执行中的取消其上下文
+	t.mu.Lock()
+	t.canceled = true
+	cancel := t.cancel
+	t.mu.Unlock()
+
+	if cancel != nil { // running. 执行中
+		cancel()
+		return
+	}
+	t.finish(context.Canceled)
+}
+
+// Done Closed once the task finished, was canceled before it ran or was discarded by the pool
+func (t *Task) Done() <-chan struct{} { // 任务结束时关闭
+	return t.done
+}
+
+// Err Error of the task once Done is closed, context.Canceled if it was canceled before it ran
+// and ErrPoolClosed if the pool discarded it
+func (t *Task) Err() error { // 任务结束后的错误
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// start Mark the task running, false if it already finished
+func (t *Task) start(ctx context.Context) (context.Context, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return nil, false
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	return ctx, true
+}
+
+// finish Record the result once and close done
+func (t *Task) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return
+	}
+	t.finished = true
+	t.err = err
+	if t.cancel != nil {
+		t.cancel() // release the task context. 释放任务上下文
+	}
+	close(t.done)
+}
+
+func (t *Task) isCanceled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.canceled
+}
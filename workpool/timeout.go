@@ -0,0 +1,28 @@
+package workpool
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutError reported for a task that exceeded its timeout or deadline,
+// use errors.As to tell it from a task failure, errors.Is(err, context.DeadlineExceeded) still holds
+type TimeoutError struct {
+	ID       string        // DoWithID id of the task, empty if none. 任务标识
+	Duration time.Duration // time the task was allowed to run. 允许的执行时间
+}
+
+// Error Same message as context.DeadlineExceeded, the task id is prefixed by the pool like for any task error
+func (e *TimeoutError) Error() string { // 超时错误信息
+	return context.DeadlineExceeded.Error()
+}
+
+// Unwrap context.DeadlineExceeded
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Timeout Always true, like the net.Error of a timed out request
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
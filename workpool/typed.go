@@ -0,0 +1,204 @@
+package workpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Result value and error of a typed task
+type Result[T any] struct {
+	Value T
+	Err   error
+	Seq   int // submission order starting at 0, the index of the value in the results of Wait. 提交序号
+}
+
+// Pool typed workpool collecting the results of func() (T, error) tasks
+type Pool[T any] struct {
+	wp      *WorkPool
+	submit  sync.Mutex // one Submit at a time, so a rejected task gives its index back. 串行提交，被拒绝的任务归还序号
+	mu      sync.Mutex
+	results []T            // results in submission order. 按提交顺序保存结果
+	stream  chan Result[T] // results in completion order. 按完成顺序推送结果
+	waited  bool           // Wait returned. 已等待结束
+}
+
+// NewTyped new typed workpool and set the max number of concurrencies
+func NewTyped[T any](max int, opts ...Option) *Pool[T] { // 注册带返回值的工作池
+	return NewTypedWithContext[T](context.Background(), max, opts...)
+}
+
+// NewTypedWithContext new typed workpool bound to ctx
+func NewTypedWithContext[T any](ctx context.Context, max int, opts ...Option) *Pool[T] { // 注册绑定上下文的带返回值工作池
+	return &Pool[T]{wp: NewWithContext(ctx, max, opts...)}
+}
+
+// Submit Add to the workpool and return immediately, the result keeps its submission index
+// A rejected task returns the error of Do, ErrPoolClosed once the pool stopped, and takes no index in the results
+func (p *Pool[T]) Submit(fn func() (T, error)) error { // 添加到工作池，结果按提交顺序保存，被拒绝时返回错误且不占用序号
+	p.submit.Lock()
+	defer p.submit.Unlock()
+	p.mu.Lock()
+	index := len(p.results)
+	var zero T
+	p.results = append(p.results, zero)
+	p.mu.Unlock()
+
+	err := p.wp.Do(func() error {
+		v, err := fn()
+		p.mu.Lock()
+		p.results[index] = v
+		stream := p.stream
+		p.mu.Unlock()
+
+		if stream != nil {
+			p.send(stream, Result[T]{Value: v, Err: err, Seq: index})
+		}
+		return err
+	})
+	if err != nil { // rejected, the last index is still ours. 被拒绝，归还最后的序号
+		p.mu.Lock()
+		p.results = p.results[:index]
+		p.mu.Unlock()
+	}
+	return err
+}
+
+// send Put the result on the Results stream as set by WithResultOverflow
+func (p *Pool[T]) send(stream chan Result[T], r Result[T]) { // 按溢出策略推送到结果流
+	switch p.wp.resultOverflow {
+	case ResultDropNewest:
+		select {
+		case stream <- r:
+		default: // full. 已满
+		}
+	case ResultDropOldest:
+		for {
+			select {
+			case stream <- r:
+				return
+			default:
+			}
+			if cap(stream) == 0 { // nothing to drop. 无缓冲可丢弃
+				return
+			}
+			select {
+			case <-stream: // make room. 丢弃最旧的
+			default:
+			}
+		}
+	default:
+		select {
+		case stream <- r:
+		case <-p.wp.ctx.Done(): // nobody will read. 工作池已停止
+		}
+	}
+}
+
+// Results Stream the results as tasks complete, the channel is closed once Wait returns
+// Seq of each result tells which submission it belongs to
+// Only tasks finishing after the first call are streamed, once the WithResultBuffer buffer is full
+// workers block until the result is read unless WithResultOverflow drops results
+func (p *Pool[T]) Results() <-chan Result[T] { // 按完成顺序获取结果，Wait 结束后关闭通道
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stream == nil {
+		p.stream = make(chan Result[T], p.wp.resultBuffer)
+		if p.waited {
+			close(p.stream)
+		}
+	}
+	return p.stream
+}
+
+// Wait Waiting for the worker thread to finish executing and return the results in submission order
+func (p *Pool[T]) Wait() ([]T, error) { // 等待执行结束，返回按提交顺序排列的结果
+	err := p.wp.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.waited {
+		p.waited = true
+		if p.stream != nil {
+			close(p.stream)
+		}
+	}
+	return p.results, err
+}
+
+// WorkPool Return the underlying workpool
+func (p *Pool[T]) WorkPool() *WorkPool { // 获取底层工作池
+	return p.wp
+}
+
+// Map Run f over every item with at most max concurrent calls and return the results in item order
+// The first error stops the remaining items, like a workpool created by New(max)
+func Map[T, R any](max int, items []T, f func(T) (R, error)) ([]R, error) { // 并发执行 f，结果按输入顺序返回
+	p := NewTyped[R](max)
+	for _, item := range items {
+		item := item
+		if p.Submit(func() (R, error) {
+			return f(item)
+		}) != nil { // stopped by an error. 已出错停止
+			break
+		}
+	}
+	return p.Wait()
+}
+
+// ForEach Run f over every item with at most max concurrent calls and return the first error
+// The first error stops submitting and cancels the items not started yet
+func ForEach[T any](max int, items []T, f func(T) error) error { // 并发执行 f，返回首个错误并停止剩余任务
+	p := New(max)
+	for _, item := range items {
+		item := item
+		if p.Do(func() error {
+			return f(item)
+		}) != nil { // stopped by an error. 已出错停止
+			break
+		}
+	}
+	return p.Wait()
+}
+
+// MapStream Run f over the items read from the channel with at most max concurrent calls and stream the results
+// as they complete, memory stays bounded: items are read only while the queue has room and the workers wait
+// for the results to be received. The first error stops reading items and is sent as the last result before
+// the channel is closed, the caller must receive until the channel is closed
+// Seq of a result is the position of its item in the channel, -1 for the error sent last
+func MapStream[T, R any](max int, items <-chan T, f func(T) (R, error)) <-chan Result[R] { // 流式并发执行 f，按完成顺序输出结果，首个错误作为最后一个结果
+	out := make(chan Result[R])
+	p := New(max, WithBlockWhenFull(true))
+	go func() {
+		defer close(out)
+		seq := 0
+	read:
+		for {
+			select {
+			case item, ok := <-items:
+				if !ok {
+					break read
+				}
+				index := seq
+				seq++
+				if p.Do(func() error {
+					v, err := f(item)
+					if err != nil { // sent once the pool stopped. 停止后作为最后结果发送
+						return err
+					}
+					select {
+					case out <- Result[R]{Value: v, Seq: index}:
+					case <-p.ctx.Done(): // a task failed. 已有任务失败
+					}
+					return nil
+				}) != nil { // stopped by an error. 已出错停止
+					break read
+				}
+			case <-p.ctx.Done(): // stopped by an error. 已出错停止
+				break read
+			}
+		}
+		if err := p.Wait(); err != nil {
+			out <- Result[R]{Err: err, Seq: -1}
+		}
+	}()
+	return out
+}
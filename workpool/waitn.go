@@ -0,0 +1,116 @@
+package workpool
+
+import "sync/atomic"
+
+// waiterN a WaitN call waiting for n finished tasks
+type waiterN struct {
+	n    int64
+	done chan struct{}
+}
+
+// WaitN Block until n tasks have finished since the pool started, the pool stays open
+// Returns the first task error so far, or ErrPoolClosed if the pool stopped before n tasks finished
+func (p *WorkPool) WaitN(n int) error { // 等待 n 个任务执行结束，返回其中首个错误，不关闭工作池
+	p.mu.Lock()
+	atomic.AddInt32(&p.nWaiters, 1) // before reading the counters, see countResult. 先登记再读取计数
+	if p.finished() >= int64(n) {
+		atomic.AddInt32(&p.nWaiters, -1)
+		err := p.firstErr
+		p.mu.Unlock()
+		return err
+	}
+	w := waiterN{n: int64(n), done: make(chan struct{})}
+	p.waiters = append(p.waiters, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-p.ctx.Done(): // stopped. 工作池已停止
+		p.mu.Lock()
+		for i := range p.waiters {
+			if p.waiters[i].done == w.done {
+				p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+				atomic.AddInt32(&p.nWaiters, -1)
+				p.mu.Unlock()
+				return ErrPoolClosed
+			}
+		}
+		p.mu.Unlock() // released meanwhile. 已被唤醒
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.firstErr
+}
+
+// WaitIdle Block until the queue is empty and no task is running, then return the first task error so far
+// Unlike Wait the pool stays open for more tasks, unlike Drain the errors are returned,
+// ErrPoolClosed if the pool stopped without any task error
+func (p *WorkPool) WaitIdle() error { // 等待队列清空且没有任务执行，返回目前为止的首个错误，不关闭工作池
+	drainErr := p.Drain()
+	p.mu.Lock()
+	err := p.firstErr
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return drainErr
+}
+
+// WaitAny Return nil as soon as a task finished without error and cancel the others, for hedged requests
+// Use WithCollectErrors so a failing task does not stop the others, the pool is closed afterwards:
+// if no task succeeds WaitAny returns what Wait returns once every task finished
+func (p *WorkPool) WaitAny() error { // 任一任务成功即返回 nil 并取消其余任务，全部失败时返回 Wait 的结果
+	res := make(chan error, 1)
+	go func() {
+		res <- p.Wait()
+	}()
+	select {
+	case <-p.succeeded:
+		p.Cancel() // the rest are not needed. 取消其余任务
+		return nil
+	case err := <-res:
+		if isClosed(p.succeeded) { // succeeded last. 最后完成的任务成功
+			return nil
+		}
+		return err
+	}
+}
+
+// finished Number of tasks finished since the pool started
+func (p *WorkPool) finished() int64 {
+	return atomic.LoadInt64(&p.completed) + atomic.LoadInt64(&p.failed)
+}
+
+// countResult Count a finished task and release the WaitN calls that reached their number
+func (p *WorkPool) countResult(err error) { // 统计任务结果，唤醒达到数量的 WaitN
+	if err != nil {
+		p.mu.Lock()
+		if p.firstErr == nil {
+			p.firstErr = err
+		}
+		p.mu.Unlock()
+		atomic.AddInt64(&p.failed, 1)
+	} else {
+		if atomic.AddInt64(&p.completed, 1) == 1 { // the first success, see WaitAny. 首个成功的任务
+			close(p.succeeded)
+		}
+	}
+	if atomic.LoadInt32(&p.nWaiters) == 0 { // nobody waits. 无等待者
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	done := p.finished()
+	waiters := p.waiters[:0]
+	for _, w := range p.waiters {
+		if w.n <= done {
+			close(w.done)
+			atomic.AddInt32(&p.nWaiters, -1)
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	p.waiters = waiters
+}
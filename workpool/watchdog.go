@@ -0,0 +1,118 @@
+package workpool
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SlowTaskHandler Callback with the id and running time of a task running longer than the threshold
+type SlowTaskHandler func(id string, running time.Duration)
+
+// slowTasks start times of the running tasks, watched for WithSlowTaskThreshold
+type slowTasks struct {
+	mu      sync.Mutex
+	running map[*job]time.Time
+}
+
+func newSlowTasks() *slowTasks {
+	return &slowTasks{running: make(map[*job]time.Time)}
+}
+
+// add Record a task start, no-op when the watchdog is off
+func (s *slowTasks) add(j *job, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.running[j] = start
+	s.mu.Unlock()
+}
+
+// remove Forget a finished task, no-op when the watchdog is off
+func (s *slowTasks) remove(j *job) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.running, j)
+	s.mu.Unlock()
+}
+
+// watchSlow Report the tasks running longer than d every d until done is closed
+func watchSlow(done <-chan struct{}, s *slowTasks, d time.Duration, fn SlowTaskHandler) { // 定期检查执行过久的任务
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	type slow struct {
+		id      string
+		running time.Duration
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			var found []slow
+			s.mu.Lock()
+			for j, start := range s.running {
+				if running := now.Sub(start); running >= d {
+					found = append(found, slow{id: j.id, running: running})
+				}
+			}
+			s.mu.Unlock()
+			for _, f := range found { // outside the lock, the callback may be slow. 回调不持锁
+				fn(f.id, f.running)
+			}
+		}
+	}
+}
+
+// watchDeadlock Dump every goroutine stack once the pool made no progress for d
+// while every worker slot is taken and tasks are waiting, once per stall, until done is closed
+// done, q and task belong to this run, Reset replaces the ones of the pool
+func (p *WorkPool) watchDeadlock(done <-chan struct{}, q *taskQueue, task chan *job, d time.Duration) { // 检测疑似死锁: 所有worker占满、有任务排队且 d 内无进展时输出协程栈
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	last, reported := int64(-1), false
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			progress := p.CompletedTasks() + p.FailedTasks()
+			busy := atomic.LoadInt32(&p.used) > 0 && (p.unbounded || atomic.LoadInt32(&p.used) >= atomic.LoadInt32(&p.maxWorkers))
+			pending := q.Len() + int(atomic.LoadInt32(&p.dispatching)) + len(task)
+			if progress != last || !busy || pending == 0 {
+				last, reported = progress, false
+				continue
+			}
+			if !reported {
+				reported = true
+				p.logDeadlock(d, pending)
+			}
+		}
+	}
+}
+
+// logDeadlock Log the stacks of all goroutines to the logger, or to stderr without one
+func (p *WorkPool) logDeadlock(d time.Duration, pending int) { // 输出全部协程栈
+	if p.silent {
+		return
+	}
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	name := "workpool"
+	if p.name != "" {
+		name += " " + p.name
+	}
+	msg := fmt.Sprintf("%s: no progress for %v with %d running and %d pending tasks, possible deadlock\n%s",
+		name, d, p.Running(), pending, buf)
+	if p.logger != nil {
+		p.logger.Error(msg)
+		return
+	}
+	fmt.Fprintln(os.Stderr, msg)
+}
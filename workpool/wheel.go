@@ -0,0 +1,140 @@
+package workpool
+
+import (
+	"sync"
+	"time"
+)
+
+// wheelSlots number of slots of a timerWheel, longer delays go around the wheel
+const wheelSlots = 512
+
+// timerWheel Clock sharing one ticker between every timer, see WithTimerWheel
+// A timer fires on the first tick after its delay, so up to one tick late, the ticker only runs while timers are pending
+type timerWheel struct {
+	tick    time.Duration
+	mu      sync.Mutex
+	slots   [wheelSlots][]*wheelTimer
+	pos     int       // slot of the last tick. 上一次处理的槽
+	pending int       // timers not fired or stopped yet. 待触发的定时器数
+	running bool      // the ticker goroutine runs. 定时协程运行中
+	started time.Time // when the ticker started. 定时器启动时间
+	ticked  int64     // ticks handled since started. 启动后处理的 tick 数
+}
+
+// wheelTimer timer of a timerWheel
+type wheelTimer struct {
+	w      *timerWheel
+	f      func()
+	c      chan time.Time // NewTimer channel, nil for AfterFunc. 触发通道
+	rounds int            // turns of the wheel left. 剩余圈数
+	done   bool           // fired or stopped. 已触发或已停止
+}
+
+func newTimerWheel(tick time.Duration) *timerWheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	return &timerWheel{tick: tick}
+}
+
+func (w *timerWheel) Now() time.Time { return time.Now() }
+
+func (w *timerWheel) After(d time.Duration) <-chan time.Time { return w.NewTimer(d).C() }
+
+func (w *timerWheel) NewTimer(d time.Duration) Timer {
+	return w.add(&wheelTimer{c: make(chan time.Time, 1)}, d)
+}
+
+func (w *timerWheel) AfterFunc(d time.Duration, f func()) Timer {
+	return w.add(&wheelTimer{f: f}, d)
+}
+
+// add Schedule a timer on the slot of its delay, counted from the last tick so it never fires early
+func (w *timerWheel) add(t *wheelTimer, d time.Duration) *wheelTimer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if !w.running {
+		w.running = true
+		w.started, w.ticked = now, 0
+		go w.run(time.NewTicker(w.tick))
+	}
+	// the next tick may be due any time now. 下一个 tick 可能随时到来
+	d += now.Sub(w.started) - time.Duration(w.ticked)*w.tick
+	ticks := int((d + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	t.w, t.rounds = w, (ticks-1)/wheelSlots
+	slot := (w.pos + ticks) % wheelSlots
+	w.slots[slot] = append(w.slots[slot], t)
+	w.pending++
+	return t
+}
+
+// run Advance the wheel every tick until no timer is pending
+func (w *timerWheel) run(ticker *time.Ticker) { // 每个 tick 推进一格，没有待触发的定时器时退出
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !w.advance(now) {
+			return
+		}
+	}
+}
+
+// advance Fire the due timers of the next slot, false once the wheel is empty and the goroutine exits
+func (w *timerWheel) advance(now time.Time) bool {
+	w.mu.Lock()
+	w.pos = (w.pos + 1) % wheelSlots
+	w.ticked++
+	var due []*wheelTimer
+	left := w.slots[w.pos][:0]
+	for _, t := range w.slots[w.pos] {
+		switch {
+		case t.done: // stopped, dropped here. 已停止
+		case t.rounds > 0:
+			t.rounds--
+			left = append(left, t)
+		default:
+			t.done = true
+			w.pending--
+			due = append(due, t)
+		}
+	}
+	for i := len(left); i < len(w.slots[w.pos]); i++ {
+		w.slots[w.pos][i] = nil // release the fired timers. 释放已触发的定时器
+	}
+	w.slots[w.pos] = left
+	if w.pending == 0 {
+		w.running = false
+		for i := range w.slots { // drop the stopped ones. 清理已停止的定时器
+			w.slots[i] = nil
+		}
+	}
+	running := w.running
+	w.mu.Unlock()
+
+	for _, t := range due { // outside the lock. 不持锁
+		if t.c != nil {
+			t.c <- now
+		} else {
+			go t.f()
+		}
+	}
+	return running
+}
+
+func (t *wheelTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *wheelTimer) Stop() bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	t.w.pending--
+	return true
+}
@@ -2,70 +2,907 @@ package workpool
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"runtime"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/mattlaibybit/public/myqueue"
 )
 
 // New new workpool and set the max number of concurrencies
-func New(max int) *WorkPool { // 注册工作池，并设置最大并发数
-	if max < 1 {
-		max = 1
+// max <= 0 (Unbounded) runs every task in its own goroutine without limit, see Unbounded
+// Workers are started on demand and nothing is allocated per worker up front, so a huge max only costs
+// the goroutines the tasks actually need, Warmup is the only call starting all of them
+func New(max int, opts ...Option) *WorkPool { // 注册工作池，并设置最大并发数
+	return NewWithContext(context.Background(), max, opts...)
+}
+
+// NewWithContext new workpool bound to ctx, cancelling ctx tears down the whole pool
+func NewWithContext(ctx context.Context, max int, opts ...Option) *WorkPool { // 注册绑定上下文的工作池，上下文取消时关闭整个工作池
+	unbounded := max < 1
+	if unbounded {
+		max = Unbounded
+	}
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
 	p := &WorkPool{
-		task:         make(chan TaskHandler, 2*max),
-		errChan:      make(chan error, 1),
-		waitingQueue: myqueue.New(),
+		parent:     ctx,
+		capacity:   2 * max,
+		maxWorkers: int32(max),
+		unbounded:  unbounded,
+		failFast:   true,
+		clock:      realClock{},
+	}
+	for _, o := range opts {
+		o.apply(p)
 	}
 
-	go p.loop(max)
+	p.start()
 	return p
 }
 
-// SetTimeout Setting timeout time
+// NewHTTPPool new workpool for parallel HTTP requests: max concurrent requests, at most rps started per second
+// and timeout per request, rps <= 0 or timeout <= 0 leaves it out. Use DoContext and build the requests
+// with its ctx so a request is aborted on timeout, opts are applied afterwards
+func NewHTTPPool(max int, rps int, timeout time.Duration, opts ...Option) *WorkPool { // 注册用于并发 HTTP 请求的工作池: 并发数、每秒请求数与单个请求超时
+	preset := []Option{WithRateLimit(rps), WithTimeout(timeout)}
+	return New(max, append(preset, opts...)...)
+}
+
+// start Initialize the runtime state and start the workers
+func (p *WorkPool) start() { // 初始化运行状态并启动worker
+	// the last run may still read them, e.g. its watchdog or a Burst timer. 上一轮的检测协程或 Burst 定时器仍可能读取
+	for _, v := range []*int32{&p.closed, &p.canceled, &p.shutdown, &p.hasEvents, &p.nWaiters, &p.workerSeq, &p.used} {
+		atomic.StoreInt32(v, 0)
+	}
+	for _, v := range []*int64{&p.completed, &p.failed, &p.panics, &p.timeouts, &p.lastActivity, &p.submitted, &p.settled, &p.outstanding} {
+		atomic.StoreInt64(v, 0)
+	}
+
+	p.mu.Lock()
+	p.resetState()
+	p.mu.Unlock()
+	p.loop()
+}
+
+// resetState Fresh runtime state for a new run, must hold mu
+func (p *WorkPool) resetState() {
+	p.errs, p.errStream = nil, nil
+	p.events, p.eventsClosed = nil, false
+	p.drainCh = nil
+	p.epoch.Store(newEpoch())
+	p.barrier = nil
+	p.firstErr, p.waiters = nil, nil
+	p.crashed = ""
+	p.succeeded = make(chan struct{})
+	p.stopping = false
+	p.task = make(chan *job) // unbuffered, so the queue decides the order. 无缓冲，由队列决定顺序
+	p.errChan = make(chan error, 1)
+	p.waitingQueue = newTaskQueue(p.ringSize, p.finish)
+	p.done = make(chan struct{})
+	p.waitOnce, p.waitErr = new(sync.Once), nil
+	p.quit = make(chan struct{})
+	p.idled = make(chan struct{}, 1)
+	p.released = make(chan struct{}, 1)
+	if p.semaphore && !p.unbounded {
+		p.sem = make(chan struct{}, atomic.LoadInt32(&p.maxWorkers))
+	}
+	p.startLanes()
+	p.pauseCh, p.resumeCh = make(chan struct{}), nil
+	p.ctx, p.cancel = context.WithCancel(p.parent)
+	p.startedAt = time.Now()
+	if p.slowThreshold > 0 && p.onSlow != nil {
+		p.slow = newSlowTasks()
+	}
+	if p.concurrency > 0 {
+		p.conc = make(chan struct{}, p.concurrency)
+	}
+	if p.rateLimit > 0 {
+		p.rateTicker = time.NewTicker(time.Second / time.Duration(p.rateLimit))
+	}
+}
+
+// Reset Reuse the workpool for a new batch once Wait has returned
+// Options and the number of workers are kept, the counters start again from zero
+func (p *WorkPool) Reset() error { // Wait 结束后重置工作池以便复用
+	select {
+	case <-p.done:
+	default:
+		return ErrPoolRunning
+	}
+
+	p.start()
+	return nil
+}
+
+// SetTimeout Setting timeout time, safe to call while tasks are running
+// Tasks already started keep the timeout they started with
 func (p *WorkPool) SetTimeout(timeout time.Duration) { // 设置超时时间
-	p.timeout = timeout
+	atomic.StoreInt64(&p.timeout, int64(timeout))
+}
+
+// SetErrorHandler Setting the callback invoked for each task error and timeout
+// It is called in addition to the logger and does not change what Wait returns
+func (p *WorkPool) SetErrorHandler(fn ErrorHandler) { // 设置任务出错或超时时的回调
+	p.mu.Lock()
+	p.errorHandler = fn
+	p.mu.Unlock()
 }
 
-// Do Add to the workpool and return immediately
-func (p *WorkPool) Do(fn TaskHandler) { // 添加到工作池，并立即返回
-	if p.IsClosed() { // 已关闭
+// SetDeadline Setting a wall-clock deadline shared by every task, the zero time removes it
+// A task starting late gets less time, the earlier of the deadline and the timeout applies
+func (p *WorkPool) SetDeadline(t time.Time) { // 设置所有任务共同的截止时间，零值表示取消截止时间
+	var ns int64
+	if !t.IsZero() {
+		ns = t.UnixNano()
+	}
+	atomic.StoreInt64(&p.deadline, ns)
+}
+
+// loadDeadline The pool deadline, zero if none
+func (p *WorkPool) loadDeadline() time.Time {
+	ns := atomic.LoadInt64(&p.deadline)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// SetOnComplete Setting the callback invoked after each task with its duration and error
+// It runs on the worker, keep it short
+func (p *WorkPool) SetOnComplete(fn CompleteHandler) { // 设置任务结束后的回调(耗时与错误)，在worker上执行，不应阻塞
+	p.mu.Lock()
+	p.onComplete = fn
+	p.mu.Unlock()
+}
+
+// AddOnComplete Add a callback invoked after each task like SetOnComplete, after the callbacks already set
+func (p *WorkPool) AddOnComplete(fn CompleteHandler) { // 追加任务结束后的回调，在已设置的回调之后执行
+	if fn == nil {
 		return
 	}
-	p.waitingQueue.Push(fn)
-	// p.task <- fn
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev := p.onComplete
+	if prev == nil {
+		p.onComplete = fn
+		return
+	}
+	p.onComplete = func(elapsed time.Duration, err error) {
+		prev(elapsed, err)
+		fn(elapsed, err)
+	}
 }
 
-// DoWait Add to the workpool and wait for execution to complete before returning
-func (p *WorkPool) DoWait(task TaskHandler) { // 添加到工作池，并等待执行完成之后再返回
-	if p.IsClosed() { // closed
+// SetTaskWrapper Setting a middleware wrapping every task execution, e.g. to start and end a tracing span
+// The wrapper runs on the worker inside the panic recovery, nil removes it
+func (p *WorkPool) SetTaskWrapper(fn func(task TaskHandler) TaskHandler) { // 设置任务中间件，包装每次任务执行(如链路追踪)
+	p.mu.Lock()
+	p.taskWrapper = fn
+	p.buildChain()
+	p.mu.Unlock()
+}
+
+// Use Append a middleware applied to every task, the first one registered runs outermost
+// and the SetTaskWrapper wrapper runs innermost, closest to the task
+func (p *WorkPool) Use(mw Middleware) { // 注册任务中间件，按注册顺序由外到内执行
+	if mw == nil {
+		return
+	}
+	p.mu.Lock()
+	p.middlewares = append(p.middlewares, mw)
+	p.buildChain()
+	p.mu.Unlock()
+}
+
+// buildChain Compose the middlewares once so a task only pays for calling them, must hold mu
+func (p *WorkPool) buildChain() {
+	mws := make([]Middleware, 0, len(p.middlewares)+1)
+	mws = append(mws, p.middlewares...)
+	if p.taskWrapper != nil {
+		mws = append(mws, p.taskWrapper)
+	}
+	if len(mws) == 0 {
+		p.chain = nil
 		return
 	}
+	p.chain = func(next TaskHandler) TaskHandler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// SetPanicHandler Setting the callback invoked when a task panics
+// The panic is still returned as the task error afterwards, prefer WithPanicHandler
+func (p *WorkPool) SetPanicHandler(fn PanicHandler) { // 设置任务 panic 时的回调
+	p.mu.Lock()
+	p.panicHandler = fn
+	p.mu.Unlock()
+}
+
+// Do Add to the workpool and return immediately, ErrPoolClosed once the pool was stopped,
+// including by a task error in fail-fast mode, so a producer can stop submitting right away
+// Tasks are handed out in submission order but may start in any order, see WithFIFO
+func (p *WorkPool) Do(fn TaskHandler) error { // 添加到工作池，并立即返回，已停止时返回 ErrPoolClosed
+	return p.Submit(fn)
+}
+
+// DoArgs Add fn(args...) to the workpool, sugar for running the same function with different parameters
+func (p *WorkPool) DoArgs(fn func(args ...interface{}) error, args ...interface{}) error { // 添加到工作池，以 args 调用 fn
+	if fn == nil {
+		return p.Do(nil)
+	}
+	return p.Do(func() error {
+		return fn(args...)
+	})
+}
+
+// DoFunc1 Add fn(arg) to p, the type safe variant of DoArgs
+func DoFunc1[T any](p *WorkPool, fn func(T) error, arg T) error { // 添加到工作池，以 arg 调用 fn
+	if fn == nil {
+		return p.Do(nil)
+	}
+	return p.Do(func() error {
+		return fn(arg)
+	})
+}
+
+// MustDo Add to the workpool like Do but panic if the task is rejected, e.g. the pool is closed
+// It is meant to catch lifecycle bugs in tests and development, not for control flow, use Do to handle ErrPoolClosed
+func (p *WorkPool) MustDo(fn TaskHandler) { // 添加到工作池，被拒绝(如已关闭)时 panic，用于发现误用，不应作为流程控制
+	if err := p.Do(fn); err != nil {
+		panic("workpool: MustDo: " + err.Error())
+	}
+}
+
+// Go Add to the workpool like errgroup.Group.Go, Wait returns the first error
+func (p *WorkPool) Go(fn func() error) { // 与 errgroup.Group.Go 相同的用法，Wait 返回首个错误
+	p.Do(fn)
+}
+
+// Submit Add to the workpool and return immediately, ErrPoolClosed if the pool was closed
+// either by Wait, Cancel or a failed task
+func (p *WorkPool) Submit(fn TaskHandler) error { // 添加到工作池，并立即返回，已关闭时返回 ErrPoolClosed
+	return p.push(&job{fn: fn.withContext(), handler: fn})
+}
+
+// DoPriority Add to the workpool with a priority, higher priorities are picked up first
+// Do uses priority 0, tasks of the same priority keep their submission order, ignored with WithRingBuffer
+func (p *WorkPool) DoPriority(fn TaskHandler, priority int) error { // 添加到工作池并设置优先级，优先级高的先执行
+	return p.push(&job{fn: fn.withContext(), handler: fn, priority: priority})
+}
+
+// DoContext Add to the workpool and return immediately
+// The task context is derived from the pool context and canceled on timeout, Cancel or a failed task
+func (p *WorkPool) DoContext(fn TaskHandlerCtx) error { // 添加到工作池，任务上下文在超时或工作池停止时取消
+	return p.push(&job{fn: fn})
+}
+
+// DoWithContext Add to the workpool and return immediately, ctx captured at submission is the parent of the task context
+// The task sees the values of ctx and is canceled with ctx as well as on timeout, Cancel or a failed task,
+// a task whose ctx is done before it started is skipped and its cancellation is not a pool error
+func (p *WorkPool) DoWithContext(ctx context.Context, fn TaskHandlerCtx) error { // 添加到工作池，提交时的 ctx 作为任务上下文的父上下文，携带其值并随之取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if fn == nil { // handled as set by WithNilTaskPolicy. 按空任务策略处理
+		return p.push(&job{})
+	}
+	return p.push(&job{fn: func(tctx context.Context) error {
+		if ctx.Err() != nil { // the caller gave up. 调用方已放弃
+			return nil
+		}
+		mctx, cancel := mergeContext(ctx, tctx)
+		defer cancel()
+		err := fn(mctx)
+		if ctx.Err() != nil && errors.Is(err, context.Canceled) { // canceled by the caller, not a pool failure. 调用方取消，不计为工作池错误
+			return nil
+		}
+		return err
+	}})
+}
+
+// DoTimeout Add to the workpool with a timeout for this task only, d <= 0 means no timeout
+func (p *WorkPool) DoTimeout(fn TaskHandler, d time.Duration) error { // 添加到工作池，单独设置该任务的超时时间(d <= 0 不超时)
+	return p.push(&job{fn: fn.withContext(), handler: fn, timeout: d, hasTimeout: true})
+}
+
+// push Add the job to the waiting queue, a full queue is handled as set by WithBlockWhenFull
+func (p *WorkPool) push(j *job) error { // 放入等待队列
+	return p.pushFull(context.Background(), j, p.whenFull)
+}
+
+// pushFull Add the job to the waiting queue, growing, blocking or failing once the queue is full
+// A blocked push gives up with ctx.Err() once ctx is done
+func (p *WorkPool) pushFull(ctx context.Context, j *job, whenFull int) error { // 放入等待队列，队列已满时按 whenFull 处理
+	if j.fn == nil && p.nilTaskPolicy == NilTaskPanic { // in the caller. 在调用方 panic
+		panic(ErrNilTask)
+	}
+	if whenFull == fullResubmit {
+		if p.stopped() { // Wait may still be running the queue. Wait 执行期间仍可提交
+			return ErrPoolClosed
+		}
+	} else if p.IsClosed() { // 已关闭
+		return ErrPoolClosed
+	}
+	if whenFull == fullError && p.saturated() { // 已满
+		return ErrQueueFull
+	}
+
+	atomic.AddInt64(&p.outstanding, 1)
+	atomic.AddInt64(&p.submitted, 1) // before a worker may finish it. 先于worker结束它
+	j.epoch = p.joinEpoch()
+	var ok bool
+	if whenFull == fullBlock {
+		limit := p.capacity
+		if limit < 1 { // at least one task waits for the handoff. 至少可排队一个
+			limit = 1
+		}
+		ok = p.waitingQueue.PushWait(j, limit, ctx.Done())
+	} else if whenFull == fullResubmit {
+		ok = p.waitingQueue.PushSealed(j)
+	} else {
+		ok = p.waitingQueue.Push(j)
+	}
+	if !ok {
+		atomic.AddInt64(&p.submitted, -1)
+		p.leave(j)
+		if err := ctx.Err(); err != nil && !p.waitingQueue.IsClosed() { // gave up waiting. 放弃等待
+			return err
+		}
+		return ErrPoolClosed // closed by Wait. 已关闭
+	}
+	p.emit(TaskSubmitted, j, 0, nil)
+	return nil
+}
+
+// SubmitContext Add to the workpool like Submit, but give up with ctx.Err() if ctx is done before the task is queued
+// Only a queue full in WithBlockWhenFull(true) mode makes the submission wait, ctx does not reach the task
+func (p *WorkPool) SubmitContext(ctx context.Context, fn TaskHandler) error { // 添加到工作池，队列已满阻塞时可通过 ctx 放弃提交
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.pushFull(ctx, &job{fn: fn.withContext(), handler: fn}, p.whenFull)
+}
+
+// Resubmit Add to the workpool from inside a running task, e.g. a task rescheduling itself
+// It never blocks nor returns ErrQueueFull: the queue grows past WithQueueSize, so a worker waiting for room
+// it would only make itself cannot deadlock the pool, ErrPoolClosed once the pool was stopped
+func (p *WorkPool) Resubmit(fn TaskHandler) error { // 在任务内部再提交任务(如任务重新调度自己)，队列已满也不阻塞，避免死锁
+	return p.pushFull(context.Background(), &job{fn: fn.withContext(), handler: fn}, fullResubmit)
+}
+
+// DoSync Add to the workpool and return only once a worker started executing the task, a synchronous handoff
+// The backpressure follows the free workers instead of the queue slack, ErrPoolClosed if the task was discarded before it started
+func (p *WorkPool) DoSync(fn TaskHandler) error { // 添加到工作池，直到worker开始执行该任务才返回
+	dropped := make(chan struct{})
+	var once sync.Once
+	j := &job{fn: fn.withContext(), handler: fn, started: make(chan struct{}), drop: func() {
+		once.Do(func() { close(dropped) })
+	}}
+	ctx := p.ctx
+	if err := p.push(j); err != nil { // closed
+		return err
+	}
+	select {
+	case <-j.started:
+	case <-dropped:
+	case <-ctx.Done(): // canceled, the task may never start. 已取消，任务可能不再开始
+	}
+	select {
+	case <-dropped: // also closes started on its way out. 丢弃时同样会关闭 started
+		return ErrPoolClosed
+	default:
+	}
+	select {
+	case <-j.started:
+		return nil
+	default:
+		return ErrPoolClosed
+	}
+}
+
+// DoAdmit Add to the workpool like Do and call onWait once right before the submission blocks on a full queue
+// Only WithBlockWhenFull(true) blocks, onWait runs in the caller and is never called when there is room
+func (p *WorkPool) DoAdmit(fn TaskHandler, onWait func()) error { // 添加到工作池，队列已满需要阻塞时先调用一次 onWait
+	return p.push(&job{fn: fn.withContext(), handler: fn, onWait: onWait})
+}
+
+// DoWeighted Add to the workpool a task holding weight worker slots while it runs, like semaphore.Weighted
+// Other tasks wait until enough slots are free, ErrWeightTooLarge if weight exceeds the number of workers
+func (p *WorkPool) DoWeighted(fn TaskHandler, weight int) error { // 添加到工作池，执行时占用 weight 个worker名额
+	if weight < 1 {
+		weight = 1
+	}
+	if max := int(atomic.LoadInt32(&p.maxWorkers)); !p.unbounded && max > 0 && weight > max { // queued while parked. 暂存时照常排队
+		return ErrWeightTooLarge
+	}
+	return p.push(&job{fn: fn.withContext(), handler: fn, weight: int32(weight)})
+}
+
+// DoWithID Add to the workpool, the task errors and timeout are reported as "task <id>: <err>"
+func (p *WorkPool) DoWithID(id string, fn TaskHandler) error { // 添加到工作池并设置任务标识，错误与超时带上该标识
+	return p.push(&job{fn: fn.withContext(), handler: fn, id: id})
+}
+
+// DoDeadline Add to the workpool with a wall-clock deadline for this task only
+func (p *WorkPool) DoDeadline(fn TaskHandler, t time.Time) error { // 添加到工作池，单独设置该任务的截止时间
+	return p.push(&job{fn: fn.withContext(), handler: fn, deadline: t})
+}
+
+// TrySubmit Add to the workpool only if it is not saturated, report whether the task was accepted
+// The pool is saturated once the tasks waiting for a worker reach the queue size (WithQueueSize, 2*max by default),
+// independent of the number of workers
+func (p *WorkPool) TrySubmit(fn TaskHandler) bool { // 非阻塞提交，工作池已满或已关闭时返回false
+	return p.pushFull(context.Background(), &job{fn: fn.withContext(), handler: fn}, fullError) == nil
+}
+
+// saturated Whether the queue reached its size, with size 0 whether no worker is free
+func (p *WorkPool) saturated() bool { // 是否已满
+	pending := p.Pending()
+	if p.unbounded { // every queued task starts right away. 排队的任务立即执行
+		return p.capacity > 0 && pending >= p.capacity
+	}
+	if p.capacity == 0 { // synchronous handoff. 同步交接
+		return pending > 0 || p.Running() >= int(atomic.LoadInt32(&p.maxWorkers))
+	}
+	return pending >= p.capacity
+}
+
+// DoWait Add to the workpool and wait for execution to complete before returning
+// Returns the error of this task only, errors of other tasks do not leak in, or ErrPoolClosed if the pool stopped before the task ran
+func (p *WorkPool) DoWait(task TaskHandler) error { // 添加到工作池，并等待执行完成之后再返回
+	return p.doWait(context.Background(), task.withContext(), nil)
+}
+
+// SubmitWait same as DoWait
+func (p *WorkPool) SubmitWait(fn TaskHandler) error { // 同 DoWait
+	return p.DoWait(fn)
+}
+
+// DoWaitTimeout Add to the workpool and wait at most d for the task to complete
+// Returns ErrWaitTimeout once d passed, the task keeps running in background
+func (p *WorkPool) DoWaitTimeout(task TaskHandler, d time.Duration) error { // 添加到工作池，最多等待d时间，超时返回 ErrWaitTimeout
+	timer := p.clock.NewTimer(d)
+	defer timer.Stop()
+	return p.doWait(context.Background(), task.withContext(), timer.C())
+}
+
+// DoWaitContext Add to the workpool and wait for the task like DoWait, still running it on a worker
+// Returns ctx.Err() once ctx is done first, the task context is then canceled and a task not started yet is skipped
+func (p *WorkPool) DoWaitContext(ctx context.Context, task TaskHandlerCtx) error { // 添加到工作池并等待完成，ctx 取消时返回 ctx.Err() 并取消任务
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.doWait(ctx, task, nil)
+}
 
+// TryDoWait Add to the workpool only if it is not saturated like TrySubmit, then wait at most d for the task to complete
+// ok is false if the task was not accepted because the queue is full or the pool is closed,
+// otherwise err is the task error or ErrWaitTimeout once d passed, the task then keeps running in background
+func (p *WorkPool) TryDoWait(fn TaskHandler, d time.Duration) (err error, ok bool) { // 非阻塞提交并最多等待d时间，未能提交时 ok 为false
+	wait, err := p.pushWait(context.Background(), fn.withContext(), fullError)
+	if err != nil {
+		return err, false
+	}
+	timer := p.clock.NewTimer(d)
+	defer timer.Stop()
+	return wait(timer.C()), true
+}
+
+// doWait Add to the workpool and wait for the task, the pool to stop, ctx or timeout
+func (p *WorkPool) doWait(ctx context.Context, task TaskHandlerCtx, timeout <-chan time.Time) error {
+	wait, err := p.pushWait(ctx, task, p.whenFull)
+	if err != nil {
+		return err
+	}
+	return wait(timeout)
+}
+
+// pushWait Add to the workpool, the returned wait blocks until the task finished, the pool stopped, ctx is done or timeout
+func (p *WorkPool) pushWait(ctx context.Context, task TaskHandlerCtx, whenFull int) (wait func(timeout <-chan time.Time) error, err error) {
+	if task == nil { // handled as set by WithNilTaskPolicy, nothing to wait for. 按空任务策略处理，无需等待
+		if err := p.pushFull(context.Background(), &job{}, whenFull); err != nil {
+			return nil, err
+		}
+		return func(<-chan time.Time) error {
+			if p.nilTaskPolicy == NilTaskError {
+				return ErrNilTask
+			}
+			return nil
+		}, nil
+	}
 	doneChan := make(chan struct{})
-	p.waitingQueue.Push(TaskHandler(func() error {
+	dropped := make(chan struct{})
+	var dropOnce sync.Once
+	var taskErr error
+	if perr := p.pushFull(context.Background(), &job{drop: func() {
+		dropOnce.Do(func() { close(dropped) })
+	}, fn: func(tctx context.Context) error {
 		defer close(doneChan)
-		return task()
-	}))
-	<-doneChan
+		if ctx.Err() != nil { // the caller gave up. 调用方已放弃
+			return nil
+		}
+		if ctx.Done() != nil {
+			var cancel context.CancelFunc
+			tctx, cancel = joinCancel(tctx, ctx)
+			defer cancel()
+		}
+		taskErr = p.safeRun(func() error { // a panic is the error of the caller too. panic 同样返回给调用方
+			return task(tctx)
+		})
+		if ctx.Err() != nil && errors.Is(taskErr, context.Canceled) { // canceled by the caller, not a pool failure. 调用方取消，不计为工作池错误
+			return nil
+		}
+		return taskErr
+	}}, whenFull); perr != nil { // closed
+		return nil, perr
+	}
+
+	return func(timeout <-chan time.Time) error {
+		select {
+		case <-doneChan:
+			return taskErr
+		case <-timeout:
+			return ErrWaitTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-dropped: // discarded, e.g. by TakePending. 任务被丢弃
+		case <-p.ctx.Done(): // canceled, the task will never run. 上下文已取消
+		}
+		select {
+		case <-doneChan: // finished just before the cancel. 取消前已完成
+			return taskErr
+		default:
+			return ErrPoolClosed
+		}
+	}, nil
 }
 
 // Wait Waiting for the worker thread to finish executing
-func (p *WorkPool) Wait() error { // 等待工作线程执行结束
-	p.waitingQueue.Wait()  // 等待队列结束
-	p.waitingQueue.Close() //
+// Tasks submitted once Wait was called are refused with ErrPoolClosed, the queued ones still run
+// and running tasks may still add more with Resubmit
+// In fail-fast mode the first task error is returned, without fail-fast every error as a *MultiError
+// Safe to call more than once, later calls return the result of the first one
+func (p *WorkPool) Wait() error { // 等待工作线程执行结束，可重复调用
+	p.waitRun(p.waitOnce)
+	p.mu.Lock()
+	crashed := p.crashed
+	p.mu.Unlock()
+	if crashed != "" { // WithPanicPolicy(PanicCrash)
+		panic(crashed)
+	}
+	return p.waitErr
+}
+
+// waitRun Run wait once for the run owning once, a no-op if that run already finished
+func (p *WorkPool) waitRun(once *sync.Once) {
+	once.Do(func() {
+		p.waitErr = p.wait()
+	})
+}
+
+func (p *WorkPool) wait() error {
+	p.waitingQueue.Seal()  // 拒绝新任务，之后提交返回 ErrPoolClosed，任务内部仍可 Resubmit
+	p.Drain()              // queued and running tasks finished, none can resubmit anymore. 任务全部结束
+	p.waitingQueue.Close() // the dispatcher exits. 关闭队列，分发协程退出
 	p.waitTask()           // wait que down
+	p.mu.Lock()
+	p.stopping = true // no more workers. 不再启动worker
+	p.mu.Unlock()
+	p.bg.Wait() // the dispatcher has exited. 等待分发协程退出
 	close(p.task)
+	p.closeLanes()
 	p.wg.Wait() // 等待结束
+	p.mu.Lock()
+	if p.errStream != nil { // no task reports errors anymore. 不再有任务上报错误
+		close(p.errStream)
+	}
+	p.mu.Unlock()
+	p.closeEvents()
+	final := p.Stats()
+	p.mu.Lock()
+	p.finalStats = final
+	p.mu.Unlock()
+	close(p.done)
+	if p.rateTicker != nil {
+		p.rateTicker.Stop()
+	}
+	defer p.cancel() // release the context. 释放上下文
+
+	if !p.failFast {
+		return newMultiError(p.stopErrors())
+	}
+	if atomic.LoadInt32(&p.canceled) == 1 {
+		return ErrPoolCanceled
+	}
 	select {
 	case err := <-p.errChan:
 		return err
 	default:
+		return p.ctx.Err() // nil unless the context was canceled. 上下文取消时返回取消原因
+	}
+}
+
+// WaitTimeout Waiting for the worker thread to finish executing at most d
+// On timeout the pool is canceled and ErrWaitTimeout is returned, hung tasks keep running in background
+func (p *WorkPool) WaitTimeout(d time.Duration) error { // 最多等待d时间，超时后取消工作池并返回 ErrWaitTimeout
+	res := make(chan error, 1)
+	go func() {
+		res <- p.Wait()
+	}()
+
+	timer := p.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case err := <-res:
+		return err
+	case <-timer.C():
+		p.Cancel()
+		return ErrWaitTimeout
+	}
+}
+
+// WaitProgress Wait like Wait and call fn with the finished and submitted task counts every progressInterval
+// and once more when done, e.g. to render a progress bar, fn runs on its own goroutine and never holds a worker
+// done counts every submitted task that is over, also the skipped nil tasks, discarded tasks and returned Acquire slots
+func (p *WorkPool) WaitProgress(fn func(done, total int)) error { // 等待执行结束，并定期回调已完成与已提交的任务数
+	res := make(chan error, 1)
+	go func() {
+		res <- p.Wait()
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-res:
+			fn(int(atomic.LoadInt64(&p.settled)), int(atomic.LoadInt64(&p.submitted)))
+			return err
+		case <-ticker.C:
+			fn(int(atomic.LoadInt64(&p.settled)), int(atomic.LoadInt64(&p.submitted)))
+		}
+	}
+}
+
+// WaitContext Waiting for the worker thread to finish executing or ctx to be done
+// On ctx done ctx.Err() is returned and the pool keeps running, call Cancel to stop it,
+// a later Wait returns the result of the pool
+func (p *WorkPool) WaitContext(ctx context.Context) error { // 等待工作线程执行结束，ctx 结束时提前返回 ctx.Err()，工作池继续运行
+	res := make(chan error, 1)
+	go func() {
+		res <- p.Wait()
+	}()
+
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain Block until every task submitted so far has finished, the pool stays open for more tasks
+// Tasks submitted while draining are waited for as well, ErrPoolClosed if the pool stopped first
+func (p *WorkPool) Drain() error { // 等待已提交的任务全部执行结束，不关闭工作池
+	p.mu.Lock()
+	if atomic.LoadInt64(&p.outstanding) == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.drainCh == nil {
+		p.drainCh = make(chan struct{})
+	}
+	drained := p.drainCh
+	p.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-p.ctx.Done(): // queued tasks are discarded. 排队的任务已丢弃
+		return ErrPoolClosed
+	}
+}
+
+// finish Mark a submitted task as done, run or not, and release Drain once none is left
+func (p *WorkPool) finish(j *job) { // 任务结束，全部结束时唤醒 Drain
+	atomic.AddInt64(&p.settled, 1)
+	p.leave(j)
+}
+
+// leave Remove the job from the outstanding tasks and release Drain once none is left
+func (p *WorkPool) leave(j *job) {
+	if j != nil {
+		j.epoch.leave()
+	}
+	if atomic.AddInt64(&p.outstanding, -1) != 0 {
+		return
+	}
+	p.mu.Lock()
+	if p.drainCh != nil && atomic.LoadInt64(&p.outstanding) == 0 {
+		close(p.drainCh)
+		p.drainCh = nil
+	}
+	p.mu.Unlock()
+}
+
+// Shutdown Stop accepting tasks and wait for the queued and running ones to finish
+// Once ctx is done first the pool is canceled, the remaining tasks are abandoned and ctx.Err() is returned
+func (p *WorkPool) Shutdown(ctx context.Context) error { // 优雅关闭: 不再接受新任务，等待已提交的任务结束，ctx 结束时取消工作池
+	atomic.StoreInt32(&p.shutdown, 1)
+	res := make(chan error, 1)
+	go func() {
+		res <- p.Wait()
+	}()
+
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		p.Cancel() // cancel the running tasks. 取消执行中的任务
+		return ctx.Err()
+	}
+}
+
+// WaitAll Waiting for the worker thread to finish executing and return every error
+func (p *WorkPool) WaitAll() []error { // 等待工作线程执行结束，返回所有错误
+	err := p.Wait()
+	if err == nil {
 		return nil
 	}
+	if multi, ok := err.(*MultiError); ok && !p.failFast {
+		return multi.Errors()
+	}
+	return []error{err}
+}
+
+// Cancel Stop the workpool immediately, queued tasks are discarded
+// The pool then winds down by itself, Done is closed once the running tasks returned
+// Wait then returns ErrPoolCanceled, Cancel after Wait returned is a no-op
+func (p *WorkPool) Cancel() { // 立即停止工作池，丢弃未执行的任务，Wait 结束后调用无效
+	select {
+	case <-p.done: // already finished. 已结束
+		return
+	default:
+	}
+	atomic.StoreInt32(&p.canceled, 1)
+	atomic.StoreInt32(&p.closed, 1)
+	p.cancel()
+	go p.waitRun(p.waitOnce) // release the workers and close done, never a later run. 回收worker并关闭 done
+}
+
+// CloseNow Stop the workpool, discard the tasks not started yet and wait for the running ones to finish
+// Between Wait, which runs every queued task, and Cancel, which also cancels the running tasks: their context
+// stays valid, discarded tasks never run (DoWait and futures get ErrPoolClosed), returns what Wait returns
+func (p *WorkPool) CloseNow() error { // 停止工作池: 丢弃未开始的任务，等待执行中的任务结束(不取消其上下文)
+	atomic.StoreInt32(&p.closed, 1) // refuse submissions, workers skip what they did not start. 拒绝提交，未开始的任务不再执行
+	p.waitingQueue.Close()          // discard the queue. 丢弃排队的任务
+	return p.Wait()
+}
+
+// Resize Grow or shrink the number of workers at runtime
+// New workers are started on demand, extra workers exit after their current task,
+// the worker buffer keeps its initial size, no effect in semaphore mode
+// Resize(0) parks the pool: every worker exits, tasks are still accepted and queued until a later Resize above zero.
+// Unlike Pause, which keeps the workers alive, parking frees them; both hold the queue and either one alone keeps tasks waiting,
+// Wait blocks while tasks are queued in a parked pool
+func (p *WorkPool) Resize(n int) { // 动态调整worker数量，按需启动新worker，多余的worker执行完当前任务后退出，为0时暂存任务且不保留worker
+	if n < 0 {
+		n = 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resize(n)
+}
+
+// Burst Add extra workers for d, then scale back down on its own, for a spike of load without resizing by hand
+// Bursts add up and a Resize during a burst sets the base size, the extra workers are removed from the size the pool has when d is over,
+// they exit after their current task like on Resize, no effect in semaphore mode or on an Unbounded pool
+func (p *WorkPool) Burst(extra int, d time.Duration) { // 临时增加extra个worker，d后自动恢复，多余的worker执行完当前任务后退出
+	if extra <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping || p.IsClosed() || p.sem != nil || p.unbounded { // closed or fixed size. 已关闭或大小固定
+		return
+	}
+	base := int(atomic.LoadInt32(&p.maxWorkers)) - p.burst
+	p.burst += extra
+	p.resize(base)
+	p.clock.AfterFunc(d, func() { // scale back down. 恢复
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		base := int(atomic.LoadInt32(&p.maxWorkers)) - p.burst
+		p.burst -= extra
+		if p.stopping || p.IsClosed() { // no worker to retire, Reset starts with the base size. 无worker可退出，Reset 后按基础大小
+			atomic.StoreInt32(&p.maxWorkers, int32(base+p.burst))
+			return
+		}
+		p.resize(base)
+	})
+}
+
+// resize Set the base number of workers plus the running bursts, must hold mu
+func (p *WorkPool) resize(n int) {
+	if p.stopping || p.IsClosed() { // closed
+		return
+	}
+	if p.sem != nil || p.unbounded { // the semaphore size is fixed. 信号量大小固定
+		return
+	}
+
+	n += p.burst
+	atomic.StoreInt32(&p.maxWorkers, int32(n))
+	select {
+	case p.released <- struct{}{}: // a weighted task may fit now. 加权任务可能已可执行
+	default:
+	}
+	select {
+	case p.idled <- struct{}{}: // the dispatcher may start a worker now. 分发协程可启动新worker
+	default:
+	}
+	if extra := int(atomic.LoadInt32(&p.workers)) - n; extra > 0 {
+		quit, ctx := p.quit, p.ctx
+		go func() { // wake up idle workers to exit. 唤醒空闲的worker退出
+			for i := 0; i < extra; i++ {
+				select {
+				case quit <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Pause Stop handing queued tasks to workers, running tasks finish and new tasks stay queued
+func (p *WorkPool) Pause() { // 暂停，不再分发排队的任务
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumeCh == nil {
+		p.resumeCh = make(chan struct{})
+		close(p.pauseCh)
+	}
+}
+
+// Resume Continue handing queued tasks to workers after Pause
+func (p *WorkPool) Resume() { // 恢复分发任务
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumeCh != nil {
+		p.pauseCh = make(chan struct{})
+		close(p.resumeCh)
+		p.resumeCh = nil
+	}
+}
+
+// IsPaused Has it been paused?
+func (p *WorkPool) IsPaused() bool { // 是否已暂停
+	_, resumeCh := p.pauseState()
+	return resumeCh != nil
+}
+
+// pauseState Channel closed on Pause, or on Resume when already paused
+func (p *WorkPool) pauseState() (pauseCh, resumeCh chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pauseCh, p.resumeCh
+}
+
+// Done Closed once Wait finished or a canceled pool wound down, for use in a select
+// Reset starts a new run with a new channel
+func (p *WorkPool) Done() <-chan struct{} { // 工作池结束时关闭，可用于 select
+	return p.done
 }
 
 // IsDone Determine whether it is complete (non-blocking)
@@ -74,41 +911,221 @@ func (p *WorkPool) IsDone() bool { // 判断是否完成 (非阻塞)
 		return true
 	}
 
-	return p.waitingQueue.Len() == 0 && len(p.task) == 0
+	return p.Pending() == 0
+}
+
+// Pending Number of queued tasks not yet picked up by a worker (non-blocking)
+func (p *WorkPool) Pending() int { // 排队中尚未执行的任务数 (非阻塞)
+	return p.waitingQueue.Len() + int(atomic.LoadInt32(&p.dispatching)) + len(p.task)
 }
 
-// IsClosed Has it been closed?
-func (p *WorkPool) IsClosed() bool { // 是否已经关闭
+// PendingTasks Queued tasks not started yet, in the order they will start, the queue is unchanged
+// Only tasks submitted as a TaskHandler are listed, like for WithDeadLetter, and a task already held by the dispatcher
+// for a worker is not queued anymore
+func (p *WorkPool) PendingTasks() []TaskHandler { // 排队中尚未执行的任务，不取出
+	var tasks []TaskHandler
+	for _, j := range p.waitingQueue.Jobs() {
+		if j.handler != nil {
+			tasks = append(tasks, j.handler)
+		}
+	}
+	return tasks
+}
+
+// TakePending Remove the queued tasks not started yet and return them in the order they would have started,
+// e.g. to persist them before shutdown, they never run in this pool and Wait does not wait for them
+// The tasks PendingTasks does not list are discarded like on Cancel. A concurrent submission is either taken
+// or stays queued, those submitted afterwards are queued as usual
+func (p *WorkPool) TakePending() []TaskHandler { // 取出排队中尚未执行的任务，不再执行
+	var tasks []TaskHandler
+	for _, j := range p.waitingQueue.Take() {
+		if j.handler != nil {
+			tasks = append(tasks, j.handler)
+		}
+		j.abandon() // release a waiting submitter, e.g. DoSync. 放行等待中的提交方
+		p.finish(j)
+	}
+	return tasks
+}
+
+// MaxWorkers Configured number of workers, as set by New or Resize plus a running Burst, 0 for an Unbounded pool (non-blocking)
+func (p *WorkPool) MaxWorkers() int { // 设定的worker数 (非阻塞)
+	return int(atomic.LoadInt32(&p.maxWorkers))
+}
+
+// Len Number of queued tasks, like len of a channel, same as Pending (non-blocking)
+func (p *WorkPool) Len() int { // 排队中的任务数，同 Pending (非阻塞)
+	return p.Pending()
+}
+
+// Cap Queue size at which TrySubmit reports full and WithBlockWhenFull blocks, like cap of a channel
+func (p *WorkPool) Cap() int { // 队列容量 (WithQueueSize，默认 2*max)
+	return p.capacity
+}
+
+// Running Number of tasks being executed by a worker right now (non-blocking)
+func (p *WorkPool) Running() int { // 执行中的任务数 (非阻塞)
+	return int(atomic.LoadInt32(&p.running))
+}
+
+// GoroutineCount Number of live goroutines running tasks: workers, semaphore mode and keyed workers (non-blocking)
+// It is 0 once Wait returned. After WaitTimeout, Shutdown or CloseNow gave up waiting, a nonzero count that does not
+// go down means a task ignores its context and leaks its worker, as the pool never abandons a running task
+func (p *WorkPool) GoroutineCount() int { // 存活的执行任务的协程数，Wait 返回后为0 (非阻塞)
+	return int(atomic.LoadInt32(&p.live))
+}
+
+// LastActivity When a task last started or finished, zero before the first task (non-blocking)
+// With Pending it tells an idle pool from a stuck one, e.g. for a liveness probe
+func (p *WorkPool) LastActivity() time.Time { // 最近一次任务开始或结束的时间 (非阻塞)
+	n := atomic.LoadInt64(&p.lastActivity)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// IsClosed Has it been closed? (non-blocking)
+// True once Wait closed the queue, Shutdown or Cancel was called, a task failed in fail-fast mode or the context is done
+func (p *WorkPool) IsClosed() bool { // 是否已经关闭 (非阻塞)
+	if p.stopped() || atomic.LoadInt32(&p.shutdown) == 1 {
+		return true
+	}
+	return p.waitingQueue.IsClosed() // closed by Wait. 已由 Wait 关闭
+}
+
+// stopped Whether the workpool stopped running tasks, queued tasks are discarded
+func (p *WorkPool) stopped() bool { // 是否已停止执行任务
 	if atomic.LoadInt32(&p.closed) == 1 { // closed
 		return true
 	}
-	return false
+	return p.ctx.Err() != nil // context canceled. 上下文已取消
 }
 
 func (p *WorkPool) startQueue() {
-	p.isQueTask = 1
+	defer p.bg.Done()
+	atomic.StoreInt32(&p.isQueTask, 1)
 	for {
-		tmp := p.waitingQueue.Pop()
-		if p.IsClosed() { // closed
+		j := p.waitingQueue.Pop()
+		if p.stopped() { // closed
+			if j != nil {
+				j.abandon()
+				p.finish(j)
+			}
 			p.waitingQueue.Close()
 			break
 		}
-		if tmp != nil {
-			fn := tmp.(TaskHandler)
-			if fn != nil {
-				p.task <- fn
-			}
-		} else {
+		if j == nil { // queue closed. 队列已关闭
 			break
 		}
 
+		if p.fifo && j.started == nil { // hold the next job until this one started. 等待该任务开始后再分发下一个
+			j.started = make(chan struct{})
+		}
+		atomic.StoreInt32(&p.dispatching, 1)
+		if !p.acquire(j) { // abandoned. 已丢弃
+			p.finish(j)
+		} else if j.lend != nil { // borrowed by Acquire. 由 Acquire 借用
+			p.lend(j)
+		} else if !p.dispatch(j) { // abandoned. 已丢弃
+			p.release(j)
+			p.finish(j)
+		} else if p.fifo {
+			<-j.started
+		}
+		atomic.StoreInt32(&p.dispatching, 0)
 	}
 	atomic.StoreInt32(&p.isQueTask, 0)
 }
 
+// acquire Wait until the weight of the job fits in the free worker slots, false if the pool stopped first
+// A job always fits once nothing runs, so a Resize below its weight does not hold it forever, unless the pool is parked by Resize(0)
+func (p *WorkPool) acquire(j *job) bool { // 等待足够的worker空位
+	w := j.slots()
+	for {
+		used, max := atomic.LoadInt32(&p.used), atomic.LoadInt32(&p.maxWorkers)
+		if p.unbounded || (max > 0 && (used == 0 || used+w <= max)) {
+			atomic.AddInt32(&p.used, w) // only the dispatcher adds. 只有分发协程增加
+			return true
+		}
+		select {
+		case <-p.released:
+		case <-p.ctx.Done(): // stop dispatching. 停止分发
+			j.abandon()
+			return false
+		}
+	}
+}
+
+// release Give back the worker slots of the job and wake up the dispatcher
+func (p *WorkPool) release(j *job) { // 释放worker空位
+	atomic.AddInt32(&p.used, -j.slots())
+	select {
+	case p.released <- struct{}{}:
+	default: // already woken up. 已唤醒
+	}
+}
+
+// dispatch Hand the job to a worker, holding it while the pool is paused
+// Report whether a worker took it, false if it was abandoned
+func (p *WorkPool) dispatch(j *job) bool { // 分发任务到worker，暂停时等待恢复
+	for {
+		pauseCh, resumeCh := p.pauseState()
+		if resumeCh != nil { // paused. 已暂停
+			select {
+			case <-resumeCh:
+				continue
+			case <-p.ctx.Done(): // stop dispatching. 停止分发
+				j.abandon()
+				return false
+			}
+		}
+
+		if p.unbounded { // one goroutine per task without limit. 不限并发
+			p.goExecute(j)
+			return true
+		}
+		if p.sem != nil { // semaphore mode, one goroutine per task. 信号量模式
+			select {
+			case p.sem <- struct{}{}:
+				p.goExecute(j)
+				return true
+			case <-pauseCh: // paused while waiting for a slot. 等待空位时被暂停
+				continue
+			case <-p.ctx.Done(): // stop dispatching. 停止分发
+				j.abandon()
+				return false
+			}
+		}
+
+		if j.keyed && p.lanes != nil && p.toLane(j) { // WithKeyedRouting
+			return true
+		}
+		select {
+		case p.task <- j: // an idle worker took it. 空闲worker接收
+			return true
+		default:
+		}
+
+		p.grow() // every worker is busy. 所有worker都在忙
+		select {
+		case p.task <- j:
+			return true
+		case <-p.idled: // a worker exited or the pool was resized meanwhile. 期间有worker空闲退出或调整了worker数量
+		case <-pauseCh: // paused while waiting for a worker. 等待worker时被暂停
+		case <-p.ctx.Done(): // stop dispatching. 停止分发
+			j.abandon()
+			return false
+		}
+	}
+}
+
 func (p *WorkPool) waitTask() {
 	for {
 		runtime.Gosched() // 出让时间片
+		if p.ctx.Err() != nil {
+			break // canceled, queued tasks are abandoned. 已取消，放弃排队的任务
+		}
 		if p.IsDone() {
 			if atomic.LoadInt32(&p.isQueTask) == 0 {
 				break
@@ -117,49 +1134,539 @@ func (p *WorkPool) waitTask() {
 	}
 }
 
-func (p *WorkPool) loop(maxWorkersCount int) {
-	go p.startQueue() // Startup queue , 启动队列
+func (p *WorkPool) loop() {
+	p.bg.Add(1)
+	go p.startQueue()                              // Startup queue , 启动队列
+	go watchContext(p.ctx, p.done, p.waitingQueue) // Discard the queue on cancel, 取消时丢弃队列
+	if p.slow != nil {
+		go watchSlow(p.done, p.slow, p.slowThreshold, p.onSlow) // Warn about slow tasks, 检查执行过久的任务
+	}
+	if p.deadlockAfter > 0 {
+		go p.watchDeadlock(p.done, p.waitingQueue, p.task, p.deadlockAfter) // Dump the stacks once stuck, 疑似死锁时输出协程栈
+	}
+	// workers are started on demand by the dispatcher. 由分发协程按需启动worker
+}
 
-	p.wg.Add(maxWorkersCount) // Maximum number of work cycles,最大的工作协程数
-	// Start Max workers, 启动max个worker
-	for i := 0; i < maxWorkersCount; i++ {
-		go func() {
-			defer p.wg.Done()
-			// worker 开始干活
-			for wt := range p.task {
-				if wt == nil || atomic.LoadInt32(&p.closed) == 1 { // returns immediately,有err 立即返回
-					continue // It needs to be consumed before returning.需要先消费完了之后再返回，
-				}
+// Warmup Start every worker now instead of on demand, so the first tasks do not pay for it
+// Safe to call more than once, no effect in semaphore mode, a goroutine each so keep it for a reasonable max
+func (p *WorkPool) Warmup() { // 预先启动全部worker，可重复调用
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping || p.sem != nil {
+		return
+	}
+	for atomic.LoadInt32(&p.workers) < atomic.LoadInt32(&p.maxWorkers) {
+		p.spawn()
+	}
+}
+
+// grow Start one more worker unless the pool already runs max workers
+func (p *WorkPool) grow() { // 未达到最大数量时启动一个worker
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping {
+		return
+	}
+	if atomic.LoadInt32(&p.workers) < atomic.LoadInt32(&p.maxWorkers) {
+		p.spawn()
+	}
+}
+
+// spawn Start one more worker
+func (p *WorkPool) spawn() { // 启动一个worker
+	atomic.AddInt32(&p.workers, 1)
+	p.wg.Add(1)
+	go p.worker()
+}
+
+// goExecute Run the job in its own goroutine and release its semaphore slot afterwards, if any
+func (p *WorkPool) goExecute(j *job) { // 在新协程中执行任务，结束后释放信号量
+	atomic.AddInt32(&p.workers, 1)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ctx, stop := p.workerStarted()
+		defer stop()
+		p.execute(ctx, j)
+		atomic.AddInt32(&p.workers, -1)
+		if p.sem != nil {
+			<-p.sem
+		}
+	}()
+}
+
+// worker Run tasks until the pool stops or Resize retires the worker
+func (p *WorkPool) worker() {
+	defer p.wg.Done()
+	ctx, stop := p.workerStarted()
+	defer stop()
+	handled := 0
+	stagger := p.startupDelay()
+	var idle *time.Timer
+	var idleC <-chan time.Time
+	if p.idleTimeout > 0 {
+		idle = time.NewTimer(p.idleTimeout)
+		defer idle.Stop()
+		idleC = idle.C
+	}
 
-				closed := make(chan struct{}, 1)
-				// Set timeout, priority task timeout.有设置超时,优先task 的超时
-				if p.timeout > 0 {
-					ct, cancel := context.WithTimeout(context.Background(), p.timeout)
-					go func() {
-						select {
-						case <-ct.Done():
-							p.errChan <- ct.Err()
-							// if atomic.LoadInt32(&p.closed) != 1 {
-							// mylog.Error(ct.Err())
-							atomic.StoreInt32(&p.closed, 1)
-							cancel()
-						case <-closed:
-						}
-					}()
+	// worker 开始干活
+	for {
+		select {
+		case <-p.ctx.Done(): // stop pulling tasks. 上下文取消，停止取任务
+			atomic.AddInt32(&p.workers, -1)
+			return
+		case <-p.quit: // woken up by Resize. 缩容唤醒
+		case <-idleC: // idle for too long. 空闲超时
+			if p.retireIdle() {
+				return
+			}
+		case j, ok := <-p.task:
+			if !ok {
+				atomic.AddInt32(&p.workers, -1)
+				return
+			}
+			if stagger > 0 { // spread the first tasks of the workers started together. 错开同时启动的worker的首个任务
+				timer := time.NewTimer(stagger)
+				select {
+				case <-timer.C:
+				case <-p.ctx.Done():
+					timer.Stop()
 				}
+				stagger = 0
+			}
+			p.execute(ctx, j)
+			handled++
+		}
 
-				err := wt() // Points of Execution.真正执行的点
-				close(closed)
-				if err != nil {
-					select {
-					case p.errChan <- err:
-						// if atomic.LoadInt32(&p.closed) != 1 {
-						// mylog.Error(err)
-						atomic.StoreInt32(&p.closed, 1)
-					default:
-					}
+		if p.retire() { // shrink after the current task. 执行完当前任务后缩容
+			return
+		}
+		if p.recycleAfter > 0 && handled >= p.recycleAfter {
+			p.recycle()
+			return
+		}
+		if idle != nil {
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
 				}
 			}
-		}()
+			idle.Reset(p.idleTimeout)
+		}
+	}
+}
+
+// startupDelay Random delay before the first task of a worker started within WithStartupStagger of the pool start
+func (p *WorkPool) startupDelay() time.Duration { // 启动错开的随机延迟
+	if p.stagger <= 0 || time.Since(p.startedAt) >= p.stagger {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(p.stagger)))
+}
+
+// workerStarted Give the new worker goroutine an id and run the start callbacks
+// Return the parent context of the worker's tasks, carrying its WithWorkerValue value, and the stop callbacks
+func (p *WorkPool) workerStarted() (context.Context, func()) { // worker 启动回调，返回任务的上下文与退出回调
+	ctx := p.ctx
+	atomic.AddInt32(&p.live, 1)
+	if p.onWorkerStart == nil && p.onWorkerStop == nil && p.openWorkerValue == nil && atomic.LoadInt32(&p.hasEvents) == 0 {
+		return ctx, p.workerExited
+	}
+	id := int(atomic.AddInt32(&p.workerSeq, 1))
+	p.emit(WorkerStarted, nil, id, nil)
+	if p.onWorkerStart != nil {
+		p.onWorkerStart(id)
+	}
+	var v interface{}
+	if p.openWorkerValue != nil {
+		v = p.openWorkerValue(id)
+		ctx = context.WithValue(ctx, workerValueKey{p}, v)
+	}
+	return ctx, func() {
+		if p.closeWorkerValue != nil {
+			p.closeWorkerValue(v)
+		}
+		if p.onWorkerStop != nil {
+			p.onWorkerStop(id)
+		}
+		p.emit(WorkerStopped, nil, id, nil)
+		p.workerExited()
+	}
+}
+
+// workerExited Count the worker goroutine out, see GoroutineCount
+func (p *WorkPool) workerExited() {
+	atomic.AddInt32(&p.live, -1)
+}
+
+// workerValueKey context key of the WithWorkerValue value, one per pool so nested pools do not collide
+type workerValueKey struct {
+	p *WorkPool
+}
+
+// WorkerValue Return the WithWorkerValue value of the worker running the task owning ctx, nil if none
+func (p *WorkPool) WorkerValue(ctx context.Context) interface{} { // 获取执行当前任务的worker的独占值
+	return ctx.Value(workerValueKey{p})
+}
+
+// recycle Replace the worker with a fresh goroutine
+func (p *WorkPool) recycle() { // 用新的worker替换当前worker
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	atomic.AddInt32(&p.workers, -1)
+	if !p.stopping {
+		p.spawn()
+	}
+}
+
+// retire Exit the worker if there are more workers than the pool size
+func (p *WorkPool) retire() bool { // worker 数量超过设定值时退出
+	for {
+		n := atomic.LoadInt32(&p.workers)
+		if n <= atomic.LoadInt32(&p.maxWorkers) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.workers, n, n-1) {
+			return true
+		}
+	}
+}
+
+// retireIdle Exit an idle worker and wake up the dispatcher, which starts a new one if a task is waiting
+func (p *WorkPool) retireIdle() bool { // 空闲worker退出，唤醒分发协程按需重新启动
+	atomic.AddInt32(&p.workers, -1)
+	select {
+	case p.idled <- struct{}{}:
+	default: // already woken up. 已唤醒
+	}
+	return true
+}
+
+// execute Run one task on the current worker, the task context derives from ctx
+func (p *WorkPool) execute(ctx context.Context, j *job) { // 在当前worker上执行任务
+	defer p.finish(j)
+	defer p.release(j)
+	if j != nil && j.started != nil {
+		defer j.begin() // release the dispatcher on every path. 任何情况下都放行分发协程
+	}
+	if j == nil || j.fn == nil { // nothing to run. 空任务
+		if p.nilTaskPolicy == NilTaskError && !p.stopped() {
+			err := j.wrapErr(ErrNilTask)
+			p.reportError(err)
+			p.countResult(err)
+		}
+		return
+	}
+	if p.stopped() { // returns immediately,有err 立即返回
+		j.abandon()
+		return // It needs to be consumed before returning.需要先消费完了之后再返回，
+	}
+
+	if p.rateTicker != nil { // wait for the rate limit before the timeout starts. 限速，不计入超时
+		select {
+		case <-p.rateTicker.C:
+		case <-p.ctx.Done():
+			j.abandon()
+			return
+		}
+	}
+	if p.conc != nil { // WithConcurrency, not part of the timeout either. 并发上限，不计入超时
+		select {
+		case p.conc <- struct{}{}:
+			defer func() { <-p.conc }()
+		case <-p.ctx.Done():
+			j.abandon()
+			return
+		}
+	}
+
+	var timer Timer
+	var fired chan struct{}
+	var timeoutErr *TimeoutError
+	// Set timeout, priority task timeout.有设置超时,优先task 的超时
+	timeout := time.Duration(atomic.LoadInt64(&p.timeout))
+	if j.hasTimeout {
+		timeout = j.timeout
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = p.clock.Now().Add(timeout)
+	}
+	// the earliest of the timeout and the deadlines. 取超时与截止时间中最早的
+	for _, d := range []time.Time{p.loadDeadline(), j.deadline} {
+		if !d.IsZero() && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+	}
+	if !deadline.IsZero() {
+		ct, cancel := p.withDeadline(ctx, deadline)
+		defer cancel() // the task context is canceled on timeout. 超时取消任务的上下文
+		ctx = ct
+		cc, _ := ct.(*clockContext)
+		// report the timeout even if the task ignores ctx, no goroutine until it fires. 超时即上报，触发前不占用协程
+		fired = make(chan struct{})
+		allowed := deadline.Sub(p.clock.Now())
+		timeoutErr = &TimeoutError{ID: j.id, Duration: allowed}
+		report := func() {
+			defer close(fired)
+			if cc != nil { // the task context first, like context.WithDeadline. 先结束任务上下文
+				cc.expire()
+			}
+			atomic.AddInt64(&p.timeouts, 1)
+			err := j.wrapErr(timeoutErr)
+			p.emit(TaskTimedOut, j, 0, err)
+			p.reportError(err)
+		}
+		if cc != nil {
+			timer = cc.afterFunc(p.clock, allowed, report)
+		} else {
+			timer = p.clock.AfterFunc(allowed, report)
+		}
+	}
+
+	run := TaskHandler(func() error {
+		return j.fn(ctx)
+	})
+	p.mu.Lock()
+	chain := p.chain
+	p.mu.Unlock()
+	if chain != nil {
+		run = chain(run)
+	}
+
+	j.begin()
+	p.emit(TaskStarted, j, 0, nil)
+	atomic.AddInt32(&p.running, 1)
+	start := p.clock.Now()
+	atomic.StoreInt64(&p.lastActivity, start.UnixNano())
+	// the watchdog ticks on the system clock. 慢任务检测使用系统时钟
+	p.slow.add(j, time.Now())
+	err := p.safeRun(run) // Points of Execution.真正执行的点
+	elapsed := p.clock.Now().Sub(start)
+	atomic.StoreInt64(&p.lastActivity, start.Add(elapsed).UnixNano())
+	p.slow.remove(j)
+	atomic.AddInt32(&p.running, -1)
+	timedOut := timer != nil && !timer.Stop()
+	if timedOut {
+		<-fired // the timeout is being reported. 等待超时上报结束
+	}
+	if err == errTaskCanceled { // canceled by its handle, no result to count. 由句柄取消，不计结果
+		return
+	}
+	if err == context.DeadlineExceeded && timeoutErr != nil && ctx.Err() == context.DeadlineExceeded { // the task returned ctx.Err(). 任务返回了 ctx.Err()
+		err = timeoutErr
+	}
+	if timedOut && (err == timeoutErr || err == nil) { // reported by the timer already, failed even if it returned nil. 超时已上报，即使返回 nil 也算失败
+		err = j.wrapErr(timeoutErr)
+		if p.deadLetter != nil && j.handler != nil {
+			p.deadLetter(j.handler, err)
+		}
+	} else if err != nil {
+		err = j.wrapErr(err)
+		p.emit(TaskFailed, j, 0, err)
+		p.reportError(err)
+		if p.deadLetter != nil && j.handler != nil {
+			p.deadLetter(j.handler, err)
+		}
+	} else {
+		p.emit(TaskCompleted, j, 0, nil)
+	}
+	p.countResult(err)
+
+	p.mu.Lock()
+	onComplete := p.onComplete
+	p.mu.Unlock()
+	if onComplete != nil { // after the timeout stopped. 不计入超时
+		onComplete(elapsed, err)
+	}
+}
+
+// reportError Log the task error, pass it to the error handler and record it
+func (p *WorkPool) reportError(err error) { // 上报任务错误: 日志、错误回调、记录
+	p.logError(err)
+	p.mu.Lock()
+	handler, stream := p.errorHandler, p.errStream
+	p.mu.Unlock()
+	if handler != nil {
+		handler(err)
+	}
+	if stream != nil {
+		p.streamError(stream, err)
+	}
+	p.setError(err)
+}
+
+// streamError Send err on the Errors stream as set by WithErrorOverflow
+func (p *WorkPool) streamError(stream chan error, err error) { // 按溢出策略推送到错误流
+	switch p.errOverflow {
+	case ErrorDropNewest:
+		select {
+		case stream <- err:
+		default: // full. 已满
+		}
+	case ErrorDropOldest:
+		for {
+			select {
+			case stream <- err:
+				return
+			default:
+			}
+			if cap(stream) == 0 { // nothing to drop. 无缓冲可丢弃
+				return
+			}
+			select {
+			case <-stream: // make room. 丢弃最旧的
+			default:
+			}
+		}
+	default:
+		select {
+		case stream <- err:
+		case <-p.ctx.Done(): // nobody reads after the pool stopped. 工作池已停止
+		}
+	}
+}
+
+// Errors Stream every task error and timeout as it happens, the channel is closed when Wait returns
+// Call it before submitting, once the buffer (WithErrorBuffer) is full a failing task waits until its error
+// is received or the pool stops, unless WithErrorOverflow drops errors instead
+func (p *WorkPool) Errors() <-chan error { // 实时获取任务错误，Wait 结束时关闭
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.errStream == nil {
+		p.errStream = make(chan error, p.errBuffer)
+	}
+	return p.errStream
+}
+
+// logError Log a task error if a logger is set and the pool is not silent
+func (p *WorkPool) logError(err error) { // 记录错误日志
+	if p.logger != nil && !p.silent {
+		if p.name != "" {
+			p.logger.Error(fmt.Sprintf("workpool %s: %v", p.name, err))
+			return
+		}
+		p.logger.Error(err)
+	}
+}
+
+// setError Record a task error, in fail-fast mode the first one closes the pool
+// Without fail-fast every error is kept in errs, only fail-fast mode keeps the first one alone on errChan
+func (p *WorkPool) setError(err error) { // 记录错误，快速失败模式下首个错误关闭工作池
+	if !p.failFast {
+		p.mu.Lock()
+		p.errs = append(p.errs, err)
+		p.mu.Unlock()
+		return
+	}
+
+	select {
+	case p.errChan <- err:
+		atomic.StoreInt32(&p.closed, 1)
+		p.cancel() // stop the remaining tasks. 停止剩余任务
+	default:
+	}
+}
+
+// stopErrors Collected errors followed by the reason the pool stopped, if any
+func (p *WorkPool) stopErrors() []error { // 收集的错误及停止原因
+	p.mu.Lock()
+	errs := append([]error(nil), p.errs...)
+	p.mu.Unlock()
+
+	if atomic.LoadInt32(&p.canceled) == 1 {
+		errs = append(errs, ErrPoolCanceled)
+	} else if err := p.ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// safeRun Run the task and convert a panic into an error
+func (p *WorkPool) safeRun(wt TaskHandler) (err error) { // 执行任务，panic 转换为错误返回
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&p.panics, 1)
+			p.mu.Lock()
+			handler := p.panicHandler
+			p.mu.Unlock()
+			stack := debug.Stack()
+			if handler != nil {
+				handler(r, stack)
+			}
+			switch p.panicPolicy {
+			case PanicIgnore:
+				err = nil
+			case PanicCrash:
+				p.crash(fmt.Sprintf("workpool: task panic: %v\n\n%s", r, stack))
+				err = fmt.Errorf("workpool: panic: %v", r)
+			default:
+				err = fmt.Errorf("workpool: panic: %v", r)
+			}
+		}
+	}()
+	return wt()
+}
+
+// crash Keep the first panic for Wait to raise again and stop the pool
+func (p *WorkPool) crash(msg string) { // 记录首个 panic 并停止工作池
+	p.mu.Lock()
+	if p.crashed == "" {
+		p.crashed = msg
+	}
+	p.mu.Unlock()
+	atomic.StoreInt32(&p.closed, 1)
+	p.cancel()
+}
+
+// mergedContext Context of the task canceled with both contexts, values are looked up in the submission context first
+type mergedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c mergedContext) Value(key interface{}) interface{} {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// mergeContext Derive the task context from tctx, also canceled with submit and carrying its values and deadline
+func mergeContext(submit, tctx context.Context) (context.Context, context.CancelFunc) { // 合并提交时的上下文与任务上下文
+	ctx, cancel := joinCancel(tctx, submit)
+	if d, ok := submit.Deadline(); ok {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, d)
+		stop := cancel
+		cancel = func() {
+			cancelDeadline()
+			stop()
+		}
+	}
+	return mergedContext{Context: ctx, values: submit}, cancel
+}
+
+// joinCancel Derive a context from parent that is also canceled with other
+func joinCancel(parent, other context.Context) (context.Context, context.CancelFunc) { // 派生上下文，other 取消时一并取消
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-other.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// watchContext Close the waiting queue once the context is canceled
+func watchContext(ctx context.Context, done <-chan struct{}, q *taskQueue) { // 上下文取消时关闭等待队列
+	select {
+	case <-ctx.Done():
+		q.Close() // discard queued tasks. 丢弃排队的任务
+	case <-done:
 	}
 }
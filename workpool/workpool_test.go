@@ -1,7 +1,15 @@
 package workpool
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -104,3 +112,4227 @@ func TestWorkerPoolIsDone(t *testing.T) {
 	fmt.Println(wp.IsDone())
 	fmt.Println("down")
 }
+
+// Cancelling the parent context tears down the pool
+func TestWorkerPoolContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wp := NewWithContext(ctx, 2) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		ii := i
+		wp.Do(func() error {
+			fmt.Println(fmt.Sprintf("%v->\trun", ii))
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	cancel()
+	err := wp.Wait()
+	if err != context.Canceled {
+		t.Errorf("Wait() = %v, want %v", err, context.Canceled)
+	}
+	fmt.Println(wp.IsClosed())
+	fmt.Println("down")
+}
+
+// Cancel stops the pool immediately and discards queued tasks
+func TestWorkerPoolCancel(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 20; i++ {
+		wp.Do(func() error {
+			atomic.AddInt32(&count, 1)
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	wp.Cancel()
+	wp.DoWait(func() error { // returns immediately after cancel
+		return nil
+	})
+	err := wp.Wait()
+	if err != ErrPoolCanceled {
+		t.Errorf("Wait() = %v, want %v", err, ErrPoolCanceled)
+	}
+	if n := atomic.LoadInt32(&count); n >= 20 {
+		t.Errorf("%v tasks ran after cancel", n)
+	}
+	fmt.Println("down")
+}
+
+// A panicking task is returned as an error instead of crashing
+func TestWorkerPoolPanic(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii == 3 {
+				panic("my test panic")
+			}
+			time.Sleep(1 * time.Millisecond)
+			return nil
+		})
+	}
+
+	err := wp.Wait()
+	if err == nil || !strings.Contains(err.Error(), "my test panic") {
+		t.Errorf("Wait() = %v, want panic error", err)
+	}
+	fmt.Println(err)
+	fmt.Println("down")
+}
+
+// The waiting submissions return the panic of their task
+func TestWorkerPoolDoWaitPanic(t *testing.T) {
+	wp := New(2, WithFailFast(false), WithSilent()) // Set the maximum number of threads
+	task := func() error { panic("my test panic") }
+	errs := map[string]error{
+		"DoWait":        wp.DoWait(task),
+		"DoWaitTimeout": wp.DoWaitTimeout(task, time.Second),
+		"DoWaitContext": wp.DoWaitContext(context.Background(), func(context.Context) error { panic("my test panic") }),
+	}
+	for name, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "my test panic") {
+			t.Errorf("%v() = %v, want the panic error", name, err)
+		}
+	}
+	if n := len(wp.WaitAll()); n != 3 || wp.Stats().Panics != 3 {
+		t.Errorf("%v errors and %v panics, want 3 each", n, wp.Stats().Panics)
+	}
+	fmt.Println("down")
+}
+
+// The panic handler sees the recovered value and stack
+func TestWorkerPoolPanicHandler(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	var recovered interface{}
+	wp.SetPanicHandler(func(r interface{}, stack []byte) {
+		recovered = r
+		fmt.Println(string(stack))
+	})
+	wp.DoWait(func() error {
+		panic("my test panic")
+	})
+
+	err := wp.Wait()
+	if recovered != "my test panic" {
+		t.Errorf("recovered = %v, want my test panic", recovered)
+	}
+	if err == nil {
+		t.Error("Wait() = nil, want panic error")
+	}
+	fmt.Println("down")
+}
+
+// Collect every task error instead of only the first
+func TestWorkerPoolCollectErrors(t *testing.T) {
+	wp := New(5, WithCollectErrors()) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii%2 == 1 {
+				return fmt.Errorf("my test err %v", ii)
+			}
+			time.Sleep(1 * time.Millisecond)
+			return nil
+		})
+	}
+
+	errs := wp.WaitAll()
+	if len(errs) != 10 {
+		t.Errorf("WaitAll() returned %v errors, want 10", len(errs))
+	}
+	fmt.Println(errs)
+	fmt.Println("down")
+}
+
+// Typed pool returns results in submission order
+func TestPoolTyped(t *testing.T) {
+	p := NewTyped[int](5) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		ii := i
+		p.Submit(func() (int, error) {
+			time.Sleep(time.Duration(20-ii) * 100 * time.Microsecond)
+			return ii * ii, nil
+		})
+	}
+
+	res, err := p.Wait()
+	if err != nil {
+		t.Error(err)
+	}
+	for i, v := range res {
+		if v != i*i {
+			t.Errorf("res[%v] = %v, want %v", i, v, i*i)
+		}
+	}
+	fmt.Println(res)
+	fmt.Println("down")
+}
+
+// A rejected typed task returns the error and takes no index in the results
+func TestPoolTypedSubmitRejected(t *testing.T) {
+	p := NewTyped[int](1) // Set the maximum number of threads
+	if err := p.Submit(func() (int, error) { return 1, nil }); err != nil {
+		t.Errorf("Submit() = %v, want nil", err)
+	}
+	for p.WorkPool().CompletedTasks() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.WorkPool().Cancel()
+	if err := p.Submit(func() (int, error) { return 2, nil }); err != ErrPoolClosed {
+		t.Errorf("Submit() after Cancel = %v, want %v", err, ErrPoolClosed)
+	}
+	res, _ := p.Wait()
+	if len(res) != 1 || res[0] != 1 {
+		t.Errorf("Wait() = %v, want [1]", res)
+	}
+
+	pl := NewPipeline(NewTyped[int](1), NewTyped[int](1), func(v int) (int, error) { return v, nil })
+	pl.up.WorkPool().Cancel()
+	if err := pl.Submit(func() (int, error) { return 1, nil }); err != ErrPoolClosed {
+		t.Errorf("Pipeline.Submit() after Cancel = %v, want %v", err, ErrPoolClosed)
+	}
+	pl.Wait()
+	fmt.Println("down")
+}
+
+// Wait for the result of a single task
+func TestWorkerPoolDoResult(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	futures := make([]*Future, 10)
+	for i := 0; i < 10; i++ {
+		ii := i
+		futures[i] = wp.DoResult(func() (interface{}, error) {
+			time.Sleep(1 * time.Millisecond)
+			return ii * 2, nil
+		})
+	}
+
+	for i, f := range futures {
+		v, err := f.Get()
+		if err != nil || v != i*2 {
+			t.Errorf("Get() = %v, %v, want %v", v, err, i*2)
+		}
+		v, _ = f.Get() // cached
+		fmt.Println(v)
+	}
+	wp.Wait()
+
+	f := wp.DoResult(func() (interface{}, error) { return 1, nil })
+	if _, err := f.Get(); err != ErrPoolClosed {
+		t.Errorf("Get() after Wait = %v, want %v", err, ErrPoolClosed)
+	}
+
+	// the future keeps the submission error. Future 保留提交时的错误
+	wp = New(1, WithQueueSize(1), WithBlockWhenFull(false)) // Set the maximum number of threads
+	release := make(chan struct{})
+	var full *Future
+	for i := 0; i < 10 && full == nil; i++ {
+		if f := wp.DoResult(func() (interface{}, error) { <-release; return nil, nil }); isDone(f) {
+			full = f
+		}
+	}
+	if full == nil {
+		t.Fatal("no submission refused on a full queue")
+	}
+	if _, err := full.Get(); err != ErrQueueFull || wp.IsClosed() {
+		t.Errorf("Get() on a full queue = %v, want %v", err, ErrQueueFull)
+	}
+	close(release)
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// isDone Whether the future already has its result
+func isDone(f *Future) bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// TrySubmit reports backpressure instead of queueing forever
+func TestWorkerPoolTrySubmit(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	release := make(chan struct{})
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		if wp.TrySubmit(func() error {
+			<-release
+			return nil
+		}) {
+			accepted++
+		}
+	}
+	if accepted == 20 {
+		t.Error("TrySubmit never reported a full pool")
+	}
+	close(release)
+	wp.Wait()
+
+	if wp.TrySubmit(func() error { return nil }) {
+		t.Error("TrySubmit accepted a task after Wait")
+	}
+	fmt.Println(accepted)
+	fmt.Println("down")
+}
+
+// Submit reports tasks dropped by a closed pool
+func TestWorkerPoolSubmit(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	if err := wp.Submit(func() error {
+		return errors.New("my test err")
+	}); err != nil {
+		t.Errorf("Submit() = %v, want nil", err)
+	}
+	for !wp.IsClosed() { // wait for the error to close the pool
+		time.Sleep(1 * time.Millisecond)
+	}
+	if err := wp.Submit(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("Submit() = %v, want %v", err, ErrPoolClosed)
+	}
+	fmt.Println(wp.Wait())
+	fmt.Println("down")
+}
+
+// WaitTimeout does not block forever on a hung task
+func TestWorkerPoolWaitTimeout(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	release := make(chan struct{})
+	defer close(release)
+	wp.Do(func() error {
+		<-release // hung task
+		return nil
+	})
+
+	if err := wp.WaitTimeout(10 * time.Millisecond); err != ErrWaitTimeout {
+		t.Errorf("WaitTimeout() = %v, want %v", err, ErrWaitTimeout)
+	}
+	if !wp.IsClosed() {
+		t.Error("pool still open after WaitTimeout")
+	}
+	fmt.Println("down")
+}
+
+// Resize the number of workers at runtime
+func TestWorkerPoolResize(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	var running, peak int32
+	task := func() error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	wp.Resize(4)
+	for i := 0; i < 8; i++ {
+		wp.Do(task)
+	}
+	for !wp.IsDone() || atomic.LoadInt32(&running) > 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&peak); n != 4 {
+		t.Errorf("peak after grow = %v, want 4", n)
+	}
+
+	wp.Resize(1)
+	time.Sleep(5 * time.Millisecond)
+	atomic.StoreInt32(&peak, 0)
+	for i := 0; i < 4; i++ {
+		wp.Do(task)
+	}
+	wp.Wait()
+	if n := atomic.LoadInt32(&peak); n != 1 {
+		t.Errorf("peak after shrink = %v, want 1", n)
+	}
+	fmt.Println("down")
+}
+
+// Runtime counters
+func TestWorkerPoolStats(t *testing.T) {
+	wp := New(5, WithCollectErrors()) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		ii := i
+		wp.Do(func() error {
+			time.Sleep(1 * time.Millisecond)
+			if ii%4 == 0 {
+				return errors.New("my test err")
+			}
+			return nil
+		})
+	}
+	fmt.Println(wp.Stats())
+
+	wp.Wait()
+	st := wp.Stats()
+	if st.Completed != 15 || st.Failed != 5 || st.MaxWorkers != 5 || st.Running != 0 {
+		t.Errorf("Stats() = %+v", st)
+	}
+	fmt.Println("down")
+}
+
+// Number of tasks waiting for a worker
+func TestWorkerPoolPending(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	for wp.Pending() != 0 { // picked up by the worker
+		time.Sleep(1 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		wp.Do(func() error { return nil })
+	}
+	time.Sleep(5 * time.Millisecond) // let the queue settle
+	if n := wp.Pending(); n != 5 {
+		t.Errorf("Pending() = %v, want 5", n)
+	}
+	close(release)
+	wp.Wait()
+	if n := wp.Pending(); n != 0 {
+		t.Errorf("Pending() after Wait = %v, want 0", n)
+	}
+	fmt.Println("down")
+}
+
+// Per-task timeout overrides the pool timeout
+func TestWorkerPoolDoTimeout(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	wp.SetTimeout(time.Millisecond)
+	wp.DoTimeout(func() error { // no timeout for this task
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}, 0)
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+
+	wp = New(5)
+	wp.DoTimeout(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, time.Millisecond)
+	if err, ok := wp.Wait().(*TimeoutError); !ok {
+		t.Errorf("Wait() = %v, want a *TimeoutError", err)
+	}
+	fmt.Println("down")
+}
+
+// The task context is canceled when the timeout fires
+func TestWorkerPoolDoContext(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	wp.SetTimeout(5 * time.Millisecond)
+	stopped := make(chan struct{})
+	wp.DoContext(func(ctx context.Context) error {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+
+	select {
+	case <-stopped:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("task context was not canceled on timeout")
+	}
+	if err, ok := wp.Wait().(*TimeoutError); !ok {
+		t.Errorf("Wait() = %v, want a *TimeoutError", err)
+	}
+	fmt.Println("down")
+}
+
+// Cancel reaches the context of running tasks
+func TestWorkerPoolDoContextCancel(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	wp.DoContext(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil
+	})
+
+	<-started
+	wp.Cancel()
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("ctx.Err() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("task context was not canceled by Cancel")
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+type testLogger struct {
+	count int32
+}
+
+func (l *testLogger) Error(a ...interface{}) {
+	atomic.AddInt32(&l.count, 1)
+	fmt.Println(a...)
+}
+
+// Task errors go to the injected logger
+func TestWorkerPoolLogger(t *testing.T) {
+	logger := &testLogger{}
+	wp := New(5, WithLogger(logger), WithCollectErrors()) // Set the maximum number of threads
+	for i := 0; i < 4; i++ {
+		wp.Do(func() error {
+			return errors.New("my test err")
+		})
+	}
+
+	wp.Wait()
+	if n := atomic.LoadInt32(&logger.count); n != 4 {
+		t.Errorf("logged %v errors, want 4", n)
+	}
+
+	logger = &testLogger{}
+	wp = New(5, WithLogger(logger), WithSilent())
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+	if err := wp.Wait(); err == nil {
+		t.Error("Wait() = nil in silent mode, want error")
+	}
+	if n := atomic.LoadInt32(&logger.count); n != 0 {
+		t.Errorf("logged %v errors in silent mode, want 0", n)
+	}
+	fmt.Println("down")
+}
+
+// Retry a failing task on the same worker
+func TestWorkerPoolDoRetry(t *testing.T) {
+	wp := New(5, WithExponentialBackoff()) // Set the maximum number of threads
+	var calls int32
+	wp.DoRetry(func() error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("my test err")
+		}
+		return nil
+	}, 5, time.Millisecond)
+	if err := wp.Wait(); err != nil || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Wait() = %v after %v calls, want nil after 3", err, calls)
+	}
+
+	wp = New(5)
+	calls = 0
+	wp.DoRetry(func() error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("my test err")
+	}, 3, time.Millisecond)
+	if err := wp.Wait(); err == nil || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Wait() = %v after %v calls, want error after 3", err, calls)
+	}
+	fmt.Println("down")
+}
+
+// Cap the task start rate regardless of the number of workers
+func TestWorkerPoolRateLimit(t *testing.T) {
+	wp := New(10, WithRateLimit(100)) // Set the maximum number of threads
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		wp.Do(func() error { return nil })
+	}
+
+	wp.Wait()
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("10 tasks at 100/s took %v", d)
+	}
+	fmt.Println("down")
+}
+
+// Higher priorities are picked up first
+func TestWorkerPoolDoPriority(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	started := make(chan struct{})
+	release := make(chan struct{})
+	wp.Do(func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	var mu sync.Mutex
+	var order []int
+	record := func(v int) TaskHandler {
+		return func() error {
+			mu.Lock()
+			order = append(order, v)
+			mu.Unlock()
+			return nil
+		}
+	}
+	wp.Do(record(0)) // held by the dispatcher while the worker is busy
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		wp.Do(record(0))
+	}
+	for i := 0; i < 3; i++ {
+		wp.DoPriority(record(1), 1)
+	}
+	close(release)
+	wp.Wait()
+
+	fmt.Println(order)
+	want := []int{0, 1, 1, 1, 0, 0, 0}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Run a batch and wait for it without closing the pool
+func TestWorkerPoolDoBatchWait(t *testing.T) {
+	wp := New(5, WithCollectErrors()) // Set the maximum number of threads
+	var count int32
+	fns := make([]TaskHandler, 10)
+	for i := range fns {
+		ii := i
+		fns[i] = func() error {
+			atomic.AddInt32(&count, 1)
+			time.Sleep(1 * time.Millisecond)
+			if ii == 5 {
+				return errors.New("my test err")
+			}
+			return nil
+		}
+	}
+
+	if err := wp.DoBatchWait(fns); err == nil || atomic.LoadInt32(&count) != 10 {
+		t.Errorf("DoBatchWait() = %v after %v tasks, want error after 10", err, count)
+	}
+	if err := wp.DoBatchWait(fns[:5]); err != nil { // the pool is still open
+		t.Errorf("DoBatchWait() = %v, want nil", err)
+	}
+	if n, err := wp.DoBatch(fns[:5]); n != 5 || err != nil {
+		t.Errorf("DoBatch() = %v, %v, want 5, nil", n, err)
+	}
+	wp.Wait()
+	if n := atomic.LoadInt32(&count); n != 20 {
+		t.Errorf("%v tasks ran, want 20", n)
+	}
+	if n, err := wp.DoBatch(fns); n != 0 || err != ErrPoolClosed {
+		t.Errorf("DoBatch() on a closed pool = %v, %v, want 0, ErrPoolClosed", n, err)
+	}
+	fmt.Println("down")
+}
+
+// Parallel map keeps the item order
+func TestMap(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	res, err := Map(3, items, func(v int) (string, error) {
+		time.Sleep(time.Duration(10-v) * 100 * time.Microsecond)
+		return fmt.Sprint(v * 10), nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	for i, v := range items {
+		if res[i] != fmt.Sprint(v*10) {
+			t.Errorf("res[%v] = %v, want %v", i, res[i], v*10)
+		}
+	}
+
+	_, err = Map(3, items, func(v int) (int, error) {
+		if v == 4 {
+			return 0, errors.New("my test err")
+		}
+		return v, nil
+	})
+	if err == nil {
+		t.Error("Map() error = nil, want my test err")
+	}
+	fmt.Println("down")
+}
+
+// Consume results as they complete
+func TestPoolResults(t *testing.T) {
+	p := NewTyped[int](5) // Set the maximum number of threads
+	results := p.Results()
+	go func() {
+		for i := 0; i < 10; i++ {
+			ii := i
+			p.Submit(func() (int, error) {
+				time.Sleep(1 * time.Millisecond)
+				return ii, nil
+			})
+		}
+		p.Wait()
+	}()
+
+	sum := 0
+	for r := range results {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+		if r.Seq != r.Value {
+			t.Errorf("result %v has Seq %v", r.Value, r.Seq)
+		}
+		sum += r.Value
+	}
+	if sum != 45 {
+		t.Errorf("sum = %v, want 45", sum)
+	}
+	fmt.Println("down")
+}
+
+// Tasks stay queued while the pool is paused
+func TestWorkerPoolPause(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	var count int32
+	wp.Pause()
+	for i := 0; i < 5; i++ {
+		wp.Do(func() error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if n := atomic.LoadInt32(&count); n != 0 || !wp.Stats().Paused {
+		t.Errorf("%v tasks ran while paused", n)
+	}
+	wp.Resume()
+	wp.Wait()
+	if n := atomic.LoadInt32(&count); n != 5 {
+		t.Errorf("%v tasks ran after resume, want 5", n)
+	}
+	fmt.Println("down")
+}
+
+// Reuse a pool after Wait
+func TestWorkerPoolReset(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	if err := wp.Reset(); err != ErrPoolRunning {
+		t.Errorf("Reset() before Wait = %v, want %v", err, ErrPoolRunning)
+	}
+	var count int32
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			wp.Do(func() error {
+				atomic.AddInt32(&count, 1)
+				return nil
+			})
+		}
+		if err := wp.Wait(); err != nil {
+			t.Error(err)
+		}
+		if err := wp.Reset(); err != nil {
+			t.Error(err)
+		}
+	}
+	if n := atomic.LoadInt32(&count); n != 30 {
+		t.Errorf("%v tasks ran, want 30", n)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Submitting after Wait is rejected instead of panicking
+func TestWorkerPoolDoAfterWait(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	wp.Do(func() error {
+		return nil
+	})
+	wp.Wait()
+
+	if err := wp.Do(func() error {
+		return nil
+	}); err != ErrPoolClosed {
+		t.Errorf("Do() after Wait = %v, want %v", err, ErrPoolClosed)
+	}
+	if err := wp.DoWait(func() error {
+		return nil
+	}); err != ErrPoolClosed {
+		t.Errorf("DoWait() after Wait = %v, want %v", err, ErrPoolClosed)
+	}
+	fmt.Println("down")
+}
+
+// Wait can be called more than once
+func TestWorkerPoolWaitTwice(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+
+	err := wp.Wait()
+	fmt.Println(err)
+	if err == nil {
+		t.Error("Wait() = nil, want the task error")
+	}
+	for i := 0; i < 3; i++ {
+		if again := wp.Wait(); again != err {
+			t.Errorf("Wait() again = %v, want %v", again, err)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Workers are started on demand and exit once idle
+func TestWorkerPoolLazyWorkers(t *testing.T) {
+	wp := New(100, WithIdleTimeout(20*time.Millisecond)) // Set the maximum number of threads
+	if n := wp.Stats().Workers; n != 0 {
+		t.Errorf("%v workers before any task, want 0", n)
+	}
+	for i := 0; i < 3; i++ {
+		wp.DoWait(func() error {
+			return nil
+		})
+		time.Sleep(1 * time.Millisecond) // let the worker go idle. 等待worker空闲
+	}
+	if n := wp.Stats().Workers; n != 1 {
+		t.Errorf("%v workers after sequential tasks, want 1", n)
+	}
+
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		wp.Do(func() error {
+			<-release
+			return nil
+		})
+	}
+	for wp.Stats().Running < 5 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if n := wp.Stats().Workers; n != 5 {
+		t.Errorf("%v workers for 5 blocked tasks, want 5", n)
+	}
+	close(release)
+
+	time.Sleep(100 * time.Millisecond)
+	if n := wp.Stats().Workers; n != 0 {
+		t.Errorf("%v workers after idle timeout, want 0", n)
+	}
+	wp.DoWait(func() error { // workers are started again. 重新启动worker
+		return nil
+	})
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Failed tasks do not stop the remaining ones
+func TestWorkerPoolContinueOnError(t *testing.T) {
+	wp := New(2, WithContinueOnError()) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			atomic.AddInt32(&count, 1)
+			if ii%2 == 0 {
+				return fmt.Errorf("my test err %v", ii)
+			}
+			return nil
+		})
+	}
+
+	errs := wp.WaitAll()
+	fmt.Println(errs)
+	if n := atomic.LoadInt32(&count); n != 10 {
+		t.Errorf("%v tasks ran, want 10", n)
+	}
+	if len(errs) != 5 {
+		t.Errorf("WaitAll() returned %v errors, want 5", len(errs))
+	}
+	fmt.Println("down")
+}
+
+// Stop on the first error only in fail-fast mode
+func TestWorkerPoolFailFast(t *testing.T) {
+	for _, failFast := range []bool{true, false} {
+		wp := New(1, WithFailFast(failFast)) // Set the maximum number of threads
+		var count int32
+		for i := 0; i < 10; i++ {
+			wp.Do(func() error {
+				atomic.AddInt32(&count, 1)
+				time.Sleep(1 * time.Millisecond)
+				return errors.New("my test err")
+			})
+		}
+		err := wp.Wait()
+		n := atomic.LoadInt32(&count)
+		fmt.Println(failFast, n, err)
+		if failFast && n == 10 {
+			t.Errorf("fail-fast pool ran all %v tasks", n)
+		}
+		if !failFast && n != 10 {
+			t.Errorf("%v tasks ran without fail-fast, want 10", n)
+		}
+		if err == nil {
+			t.Error("Wait() = nil, want an error")
+		}
+	}
+	fmt.Println("down")
+}
+
+// Configure the pool through options
+func TestWorkerPoolOptions(t *testing.T) {
+	var recovered int32
+	wp := New(1, WithTimeout(10*time.Millisecond), WithQueueSize(1), WithCollectErrors(),
+		WithPanicHandler(func(r interface{}, stack []byte) {
+			atomic.AddInt32(&recovered, 1)
+		})) // Set the maximum number of threads
+
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	for wp.Stats().Running < 1 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if !wp.TrySubmit(func() error { return nil }) {
+		t.Error("TrySubmit() = false with an empty queue")
+	}
+	if wp.TrySubmit(func() error { return nil }) {
+		t.Error("TrySubmit() = true with a full queue")
+	}
+	close(release)
+
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	wp.Do(func() error {
+		panic("my test panic")
+	})
+	errs := wp.WaitAll()
+	fmt.Println(errs)
+	if atomic.LoadInt32(&recovered) != 1 {
+		t.Error("panic handler was not called")
+	}
+	timedOut := false
+	for _, err := range errs {
+		if _, ok := err.(*TimeoutError); ok {
+			timedOut = true
+		}
+	}
+	if !timedOut {
+		t.Errorf("WaitAll() = %v, want a timeout error", errs)
+	}
+	fmt.Println("down")
+}
+
+// Change the timeout while tasks are running
+func TestWorkerPoolSetTimeoutRunning(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		wp.Do(func() error {
+			time.Sleep(1 * time.Millisecond)
+			return nil
+		})
+		wp.SetTimeout(time.Duration(i+1) * time.Second)
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// Semaphore mode keeps no idle goroutines
+func TestWorkerPoolSemaphore(t *testing.T) {
+	wp := New(3, WithSemaphore()) // Set the maximum number of threads
+	var running, peak, count int32
+	for i := 0; i < 20; i++ {
+		wp.Do(func() error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&count); n != 20 {
+		t.Errorf("%v tasks ran, want 20", n)
+	}
+	if n := atomic.LoadInt32(&peak); n != 3 {
+		t.Errorf("peak = %v, want 3", n)
+	}
+	if n := wp.Stats().Workers; n != 0 {
+		t.Errorf("%v goroutines left after Wait, want 0", n)
+	}
+	fmt.Println("down")
+}
+
+// Short tasks with a timeout
+func BenchmarkWorkPoolTimeout(b *testing.B) {
+	wp := New(8, WithTimeout(time.Second)) // Set the maximum number of threads
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	wp.Wait()
+}
+
+// Stop waiting once the caller context is done
+func TestWorkerPoolWaitContext(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := wp.WaitContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("WaitContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if wp.Stats().Running != 1 {
+		t.Error("task stopped by WaitContext")
+	}
+
+	close(release)
+	if err := wp.WaitContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// Every submission method reports a pool closed by a failed task
+func TestWorkerPoolErrPoolClosed(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	wp.DoWait(func() error {
+		return errors.New("my test err")
+	})
+	for !wp.IsClosed() { // the error is recorded after the task returns. 任务返回后记录错误
+		time.Sleep(1 * time.Millisecond)
+	}
+	task := func() error { return nil }
+
+	errs := map[string]error{
+		"Do":         wp.Do(task),
+		"Submit":     wp.Submit(task),
+		"DoWait":     wp.DoWait(task),
+		"DoPriority": wp.DoPriority(task, 1),
+		"DoTimeout":  wp.DoTimeout(task, time.Second),
+		"DoRetry":    wp.DoRetry(task, 3, 0),
+		"DoContext": wp.DoContext(func(context.Context) error {
+			return nil
+		}),
+	}
+	for name, err := range errs {
+		if err != ErrPoolClosed {
+			t.Errorf("%v() = %v, want %v", name, err, ErrPoolClosed)
+		}
+	}
+	if _, err := wp.DoResult(func() (interface{}, error) { return nil, nil }).Get(); err != ErrPoolClosed {
+		t.Errorf("DoResult() = %v, want %v", err, ErrPoolClosed)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// The pool reports closed as soon as Wait stops accepting tasks
+func TestWorkerPoolIsClosed(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	if wp.IsClosed() {
+		t.Error("IsClosed() = true before Wait")
+	}
+
+	res := make(chan error, 1)
+	go func() {
+		res <- wp.Wait()
+	}()
+	for !wp.IsClosed() {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if err := wp.Do(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("Do() while waiting = %v, want %v", err, ErrPoolClosed)
+	}
+	close(release)
+	if err := <-res; err != nil {
+		t.Error(err)
+	}
+	if !wp.IsClosed() {
+		t.Error("IsClosed() = false after Wait")
+	}
+	fmt.Println("down")
+}
+
+// Number of tasks being executed
+func TestWorkerPoolRunning(t *testing.T) {
+	wp := New(3) // Set the maximum number of threads
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		wp.Do(func() error {
+			<-release
+			return nil
+		})
+	}
+	for wp.Pending() > 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	fmt.Println(wp.Running(), wp.Pending())
+	if n := wp.Running(); n != 3 {
+		t.Errorf("Running() = %v, want 3", n)
+	}
+	close(release)
+	wp.Wait()
+	if n := wp.Running(); n != 0 {
+		t.Errorf("Running() after Wait = %v, want 0", n)
+	}
+	fmt.Println("down")
+}
+
+// Route task errors to a callback
+func TestWorkerPoolErrorHandler(t *testing.T) {
+	var mu sync.Mutex
+	var got []error
+	wp := New(5, WithCollectErrors()) // Set the maximum number of threads
+	wp.SetErrorHandler(func(err error) {
+		mu.Lock()
+		got = append(got, err)
+		mu.Unlock()
+	})
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii%2 == 0 {
+				return errors.New("my test err")
+			}
+			return nil
+		})
+	}
+	wp.DoTimeout(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, 5*time.Millisecond)
+
+	errs := wp.WaitAll()
+	fmt.Println(got)
+	if len(got) != 6 || len(errs) != 6 {
+		t.Errorf("handler got %v errors, WaitAll() %v, want 6", len(got), len(errs))
+	}
+	fmt.Println("down")
+}
+
+// Observe the duration of every task
+func TestWorkerPoolOnComplete(t *testing.T) {
+	var count, failed int32
+	wp := New(5, WithCollectErrors(), WithOnComplete(func(d time.Duration, err error) {
+		atomic.AddInt32(&count, 1)
+		if err != nil {
+			atomic.AddInt32(&failed, 1)
+		}
+		if d < 2*time.Millisecond {
+			t.Errorf("duration %v, want at least 2ms", d)
+		}
+	})) // Set the maximum number of threads
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			time.Sleep(2 * time.Millisecond)
+			if ii%5 == 0 {
+				return errors.New("my test err")
+			}
+			return nil
+		})
+	}
+	wp.Wait()
+	if atomic.LoadInt32(&count) != 10 || atomic.LoadInt32(&failed) != 2 {
+		t.Errorf("OnComplete called %v times with %v errors, want 10 and 2", count, failed)
+	}
+	fmt.Println("down")
+}
+
+// Wait for the submitted tasks and keep the pool open
+func TestWorkerPoolDrain(t *testing.T) {
+	wp := New(3) // Set the maximum number of threads
+	if err := wp.Drain(); err != nil {
+		t.Error(err)
+	}
+
+	var count int32
+	for round := 1; round <= 3; round++ {
+		for i := 0; i < 10; i++ {
+			wp.Do(func() error {
+				time.Sleep(1 * time.Millisecond)
+				atomic.AddInt32(&count, 1)
+				return nil
+			})
+		}
+		if err := wp.Drain(); err != nil {
+			t.Error(err)
+		}
+		if n := atomic.LoadInt32(&count); n != int32(10*round) {
+			t.Errorf("%v tasks finished after Drain, want %v", n, 10*round)
+		}
+	}
+	if wp.IsClosed() {
+		t.Error("pool closed by Drain")
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Queue size is independent of the number of workers
+func TestWorkerPoolQueueSize(t *testing.T) {
+	wp := New(4, WithQueueSize(10000)) // Set the maximum number of threads
+	release := make(chan struct{})
+	accepted := 0
+	for i := 0; i < 10010; i++ {
+		if wp.TrySubmit(func() error {
+			<-release
+			return nil
+		}) {
+			accepted++
+		}
+	}
+	fmt.Println(accepted)
+	if accepted < 10000 || accepted > 10004 {
+		t.Errorf("%v tasks accepted, want 10000 queued plus up to 4 running", accepted)
+	}
+	close(release)
+	wp.Wait()
+
+	wp = New(1, WithQueueSize(0)) // synchronous handoff
+	release = make(chan struct{})
+	if !wp.TrySubmit(func() error {
+		<-release
+		return nil
+	}) {
+		t.Error("TrySubmit() = false with a free worker")
+	}
+	for wp.Running() < 1 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if wp.TrySubmit(func() error { return nil }) {
+		t.Error("TrySubmit() = true with every worker busy")
+	}
+	close(release)
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Block or fail once the queue is full
+func TestWorkerPoolBlockWhenFull(t *testing.T) {
+	wp := New(1, WithQueueSize(2), WithBlockWhenFull(false)) // Set the maximum number of threads
+	release := make(chan struct{})
+	task := func() error {
+		<-release
+		return nil
+	}
+	var full int
+	for i := 0; i < 10; i++ {
+		if err := wp.Do(task); err == ErrQueueFull {
+			full++
+		}
+	}
+	fmt.Println(full)
+	if full < 6 {
+		t.Errorf("%v submissions refused, want at least 6", full)
+	}
+	close(release)
+	wp.Wait()
+
+	wp = New(1, WithQueueSize(2), WithBlockWhenFull(true))
+	var count int32
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := wp.Do(func() error {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&count, 1)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("submissions returned after %v, want them to block", d)
+	}
+	wp.Wait()
+	if n := atomic.LoadInt32(&count); n != 6 {
+		t.Errorf("%v tasks ran, want 6", n)
+	}
+	fmt.Println("down")
+}
+
+// Run a task synchronously and get its result
+func TestWorkerPoolSubmitWaitResult(t *testing.T) {
+	wp := New(2, WithCollectErrors()) // Set the maximum number of threads
+	v, err := wp.SubmitWaitResult(func() (interface{}, error) {
+		return 42, nil
+	})
+	if v != 42 || err != nil {
+		t.Errorf("SubmitWaitResult() = %v, %v, want 42, nil", v, err)
+	}
+	_, err = wp.SubmitWaitResult(func() (interface{}, error) {
+		return nil, errors.New("my test err")
+	})
+	fmt.Println(err)
+	if err == nil {
+		t.Error("SubmitWaitResult() error = nil, want the task error")
+	}
+	wp.Wait()
+	if _, err = wp.SubmitWaitResult(func() (interface{}, error) { return 1, nil }); err != ErrPoolClosed {
+		t.Errorf("SubmitWaitResult() after Wait = %v, want %v", err, ErrPoolClosed)
+	}
+	fmt.Println("down")
+}
+
+// Graceful shutdown with a deadline
+func TestWorkerPoolShutdown(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 10; i++ {
+		wp.Do(func() error {
+			time.Sleep(1 * time.Millisecond)
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+	if err := wp.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&count); n != 10 {
+		t.Errorf("%v tasks ran, want 10", n)
+	}
+
+	wp = New(1)
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := wp.Do(func() error { return nil }); err != nil {
+		t.Error(err)
+	}
+	rejected := make(chan struct{})
+	go func() {
+		defer close(rejected)
+		for !wp.IsClosed() {
+			time.Sleep(1 * time.Millisecond)
+		}
+		if err := wp.Do(func() error { return nil }); err != ErrPoolClosed {
+			t.Errorf("Do() during Shutdown = %v, want %v", err, ErrPoolClosed)
+		}
+	}()
+	if err := wp.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	<-rejected
+	if err := wp.Wait(); err != ErrPoolCanceled {
+		t.Errorf("Wait() after Shutdown = %v, want %v", err, ErrPoolCanceled)
+	}
+	fmt.Println("down")
+}
+
+// Workers keep running after a task panics
+func TestWorkerPoolPanicKeepsWorkers(t *testing.T) {
+	wp := New(4, WithCollectErrors()) // Set the maximum number of threads
+	wp.SetPanicHandler(func(interface{}, []byte) {})
+	var count int32
+	for i := 0; i < 100; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii%2 == 0 {
+				panic("my test panic")
+			}
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+
+	errs := wp.WaitAll()
+	if n := atomic.LoadInt32(&count); n != 50 {
+		t.Errorf("%v tasks ran, want 50", n)
+	}
+	if len(errs) != 50 {
+		t.Errorf("WaitAll() returned %v errors, want 50", len(errs))
+	}
+	if st := wp.Stats(); st.Workers != 0 {
+		t.Errorf("%v workers left after Wait", st.Workers)
+	}
+	fmt.Println("down")
+}
+
+// Replace workers after a number of tasks
+func TestWorkerPoolRecycleAfter(t *testing.T) {
+	wp := New(2, WithRecycleAfter(3)) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 50; i++ {
+		wp.Do(func() error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&count); n != 50 {
+		t.Errorf("%v tasks ran, want 50", n)
+	}
+	if n := wp.Stats().Workers; n != 0 {
+		t.Errorf("%v workers left after Wait", n)
+	}
+	fmt.Println("down")
+}
+
+// Cancel single tasks through their handle
+func TestWorkerPoolDoTask(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	running := wp.DoTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var ran int32
+	queued := wp.DoTask(func(ctx context.Context) error {
+		atomic.AddInt32(&ran, 1)
+		return nil
+	})
+	for wp.Running() < 1 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	queued.Cancel()
+	<-queued.Done()
+	running.Cancel()
+	<-running.Done()
+	fmt.Println(queued.Err(), running.Err())
+	if queued.Err() != context.Canceled || running.Err() != context.Canceled {
+		t.Errorf("Err() = %v, %v, want %v", queued.Err(), running.Err(), context.Canceled)
+	}
+	for wp.Running() > 0 || wp.Pending() > 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	select {
+	case <-wp.succeeded:
+		t.Error("a canceled task counted as the first success")
+	default:
+	}
+	if s := wp.Stats(); s.Completed != 0 || s.Failed != 0 {
+		t.Errorf("%v completed and %v failed, want canceled tasks counted as neither", s.Completed, s.Failed)
+	}
+
+	ok := wp.DoTask(func(ctx context.Context) error {
+		return errors.New("my test err")
+	})
+	<-ok.Done()
+	if ok.Err() == nil {
+		t.Error("Err() = nil, want the task error")
+	}
+	wp.Wait()
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Error("canceled task ran")
+	}
+
+	wp = New(1)
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	dropped := wp.DoTask(func(ctx context.Context) error { return nil })
+	wp.Cancel()
+	<-dropped.Done()
+	if err := dropped.Err(); err != ErrPoolClosed {
+		t.Errorf("Err() of a discarded task = %v, want %v", err, ErrPoolClosed)
+	}
+	if err := wp.DoTask(func(ctx context.Context) error { return nil }).Err(); err != ErrPoolClosed {
+		t.Errorf("DoTask() after Cancel = %v, want %v", err, ErrPoolClosed)
+	}
+	fmt.Println("down")
+}
+
+// Tasks share a wall-clock deadline
+func TestWorkerPoolDeadline(t *testing.T) {
+	wp := New(1, WithCollectErrors()) // Set the maximum number of threads
+	wp.SetDeadline(time.Now().Add(30 * time.Millisecond))
+	var left []time.Duration
+	for i := 0; i < 2; i++ {
+		wp.DoContext(func(ctx context.Context) error {
+			d, _ := ctx.Deadline()
+			left = append(left, time.Until(d))
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+	}
+	wp.DoDeadline(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, time.Now().Add(5*time.Millisecond))
+
+	errs := wp.WaitAll()
+	fmt.Println(left, errs)
+	if len(left) != 2 || left[1] >= left[0] {
+		t.Errorf("time left %v, want less for the later task", left)
+	}
+	var timeout *TimeoutError
+	if len(errs) == 1 {
+		timeout, _ = errs[0].(*TimeoutError)
+	}
+	if timeout == nil {
+		t.Errorf("WaitAll() = %v, want one *TimeoutError", errs)
+	}
+	fmt.Println("down")
+}
+
+// Stream task errors while the pool runs
+func TestWorkerPoolErrors(t *testing.T) {
+	wp := New(3, WithCollectErrors()) // Set the maximum number of threads
+	errc := wp.Errors()
+	got := make(chan int)
+	go func() {
+		n := 0
+		for err := range errc {
+			fmt.Println(err)
+			n++
+		}
+		got <- n
+	}()
+
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii%2 == 0 {
+				return fmt.Errorf("my test err %v", ii)
+			}
+			return nil
+		})
+	}
+	wp.DoTimeout(func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}, 1*time.Millisecond)
+	wp.Wait()
+	if n := <-got; n != 6 {
+		t.Errorf("%v errors streamed, want 6", n)
+	}
+	fmt.Println("down")
+}
+
+// Use the pool like an errgroup.Group
+func TestWorkerPoolGo(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 10; i++ {
+		wp.Go(func() error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&count); n != 10 {
+		t.Errorf("%v tasks ran, want 10", n)
+	}
+
+	wp = New(2)
+	wp.Go(func() error {
+		return errors.New("my test err")
+	})
+	if err := wp.Wait(); err == nil || err.Error() != "my test err" {
+		t.Errorf("Wait() = %v, want my test err", err)
+	}
+	fmt.Println("down")
+}
+
+// Bind the pool to a context through an option
+func TestWorkerPoolWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wp := New(2, WithContext(ctx)) // Set the maximum number of threads
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	cancel()
+	if err := wp.Wait(); err != context.Canceled {
+		t.Errorf("Wait() = %v, want %v", err, context.Canceled)
+	}
+	fmt.Println("down")
+}
+
+// Start the workers before the first task
+func TestWorkerPoolWarmup(t *testing.T) {
+	wp := New(5) // Set the maximum number of threads
+	wp.Warmup()
+	wp.Warmup()
+	if n := wp.Stats().Workers; n != 5 {
+		t.Errorf("%v workers after Warmup, want 5", n)
+	}
+	wp.Do(func() error {
+		return nil
+	})
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// Report nil tasks instead of skipping them
+func TestWorkerPoolNilTaskPolicy(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	wp.Do(nil)
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want nil with NilTaskSkip", err)
+	}
+
+	wp = New(2, WithNilTaskPolicy(NilTaskError))
+	wp.Do(nil)
+	if err := wp.Wait(); err != ErrNilTask {
+		t.Errorf("Wait() = %v, want %v", err, ErrNilTask)
+	}
+
+	wp = New(2, WithNilTaskPolicy(NilTaskPanic))
+	func() {
+		defer func() {
+			if r := recover(); r != ErrNilTask {
+				t.Errorf("recovered %v, want %v", r, ErrNilTask)
+			}
+		}()
+		wp.Do(nil)
+	}()
+	wp.Wait()
+
+	// the waiting submissions follow the policy too. 等待结果的提交方式同样遵循该策略
+	wp = New(2) // Set the maximum number of threads
+	if err := wp.DoWait(nil); err != nil {
+		t.Errorf("DoWait(nil) = %v, want nil with NilTaskSkip", err)
+	}
+	if err := wp.DoWaitContext(context.Background(), nil); err != nil {
+		t.Errorf("DoWaitContext(nil) = %v, want nil with NilTaskSkip", err)
+	}
+	if err, ok := wp.TryDoWait(nil, time.Second); err != nil || !ok {
+		t.Errorf("TryDoWait(nil) = %v, %v, want nil, true", err, ok)
+	}
+	wp.DoWithContext(context.Background(), nil)
+	if err := wp.Wait(); err != nil || wp.Stats().Failed != 0 {
+		t.Errorf("Wait() = %v with %v failed, want nil and none", err, wp.Stats().Failed)
+	}
+
+	wp = New(2, WithNilTaskPolicy(NilTaskError), WithFailFast(false), WithSilent())
+	if err := wp.SubmitWait(nil); err != ErrNilTask {
+		t.Errorf("SubmitWait(nil) = %v, want %v", err, ErrNilTask)
+	}
+	wp.DoWithContext(context.Background(), nil)
+	if errs := wp.WaitAll(); len(errs) != 2 || errs[0] != ErrNilTask {
+		t.Errorf("WaitAll() = %v, want ErrNilTask twice", errs)
+	}
+
+	wp = New(2, WithNilTaskPolicy(NilTaskPanic))
+	func() {
+		defer func() {
+			if r := recover(); r != ErrNilTask {
+				t.Errorf("recovered %v, want %v", r, ErrNilTask)
+			}
+		}()
+		wp.DoWait(nil)
+	}()
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Wait for a single task at most d
+func TestWorkerPoolDoWaitTimeout(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	if err := wp.DoWaitTimeout(func() error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}, 5*time.Millisecond); err != ErrWaitTimeout {
+		t.Errorf("DoWaitTimeout() = %v, want %v", err, ErrWaitTimeout)
+	}
+	if err := wp.DoWaitTimeout(func() error {
+		return errors.New("my test err")
+	}, time.Second); err == nil || err.Error() != "my test err" {
+		t.Errorf("DoWaitTimeout() = %v, want my test err", err)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Wait for a number of tasks without closing the pool
+func TestWorkerPoolWaitN(t *testing.T) {
+	wp := New(3, WithCollectErrors()) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 20; i++ {
+		ii := i
+		wp.Do(func() error {
+			time.Sleep(time.Duration(ii) * time.Millisecond)
+			atomic.AddInt32(&count, 1)
+			if ii == 15 {
+				return errors.New("my test err")
+			}
+			return nil
+		})
+	}
+
+	if err := wp.WaitN(5); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&count); n < 5 || n == 20 {
+		t.Errorf("%v tasks finished after WaitN(5)", n)
+	}
+	if err := wp.WaitN(20); err == nil {
+		t.Error("WaitN(20) = nil, want the task error")
+	}
+	if wp.IsClosed() {
+		t.Error("pool closed by WaitN")
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Wrap every task execution
+func TestWorkerPoolTaskWrapper(t *testing.T) {
+	wp := New(5, WithCollectErrors()) // Set the maximum number of threads
+	var before, after int32
+	wp.SetTaskWrapper(func(task TaskHandler) TaskHandler {
+		return func() error {
+			atomic.AddInt32(&before, 1)
+			defer atomic.AddInt32(&after, 1)
+			return task()
+		}
+	})
+	for i := 0; i < 10; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	wp.Do(func() error {
+		panic("my test panic")
+	})
+
+	if err := wp.Wait(); err == nil {
+		t.Error("the panic was not reported")
+	}
+	if before != 11 || after != 11 {
+		t.Errorf("wrapper ran %v/%v times, want 11", before, after)
+	}
+	fmt.Println("down")
+}
+
+// Compose middlewares in registration order
+func TestWorkerPoolUse(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next TaskHandler) TaskHandler {
+			return func() error {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return next()
+			}
+		}
+	}
+	wp.Use(record("first"))
+	wp.SetTaskWrapper(record("wrapper"))
+	wp.Use(record("second"))
+	wp.Do(func() error {
+		mu.Lock()
+		calls = append(calls, "task")
+		mu.Unlock()
+		return nil
+	})
+
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if got := strings.Join(calls, ","); got != "first,second,wrapper,task" {
+		t.Errorf("calls = %v", got)
+	}
+	fmt.Println("down")
+}
+
+// Report the task ID with its error and timeout
+func TestWorkerPoolDoWithID(t *testing.T) {
+	wp := New(2, WithCollectErrors(), WithTimeout(5*time.Millisecond)) // Set the maximum number of threads
+	errc := wp.Errors()
+	got := make(chan []string)
+	go func() {
+		var msgs []string
+		for err := range errc {
+			msgs = append(msgs, err.Error())
+		}
+		got <- msgs
+	}()
+
+	wp.DoWithID("slow", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	wp.DoWithID("broken", func() error {
+		return errors.New("my test err")
+	})
+
+	if err := wp.Wait(); err == nil {
+		t.Error("Wait() = nil, want the task errors")
+	}
+	msgs := strings.Join(<-got, "\n")
+	for _, want := range []string{"task slow: " + context.DeadlineExceeded.Error(), "task broken: my test err"} {
+		if !strings.Contains(msgs, want) {
+			t.Errorf("errors %q, want %q", msgs, want)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Encode the runtime counters as JSON
+func TestWorkerPoolStatsJSON(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	for i := 0; i < 3; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	wp.Wait()
+
+	b, err := json.Marshal(wp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st Stats
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Completed != 3 || st.MaxWorkers != 2 || !st.Closed {
+		t.Errorf("stats = %s", b)
+	}
+	if !strings.Contains(string(b), `"max_workers":2`) {
+		t.Errorf("missing json tag in %s", b)
+	}
+	fmt.Println("down")
+}
+
+// Chain two typed pools
+func TestWorkerPoolPipeline(t *testing.T) {
+	pl := NewPipeline(NewTyped[int](3), NewTyped[string](2), func(v int) (string, error) {
+		return fmt.Sprint(v * 2), nil
+	})
+	for i := 0; i < 10; i++ {
+		ii := i
+		pl.Submit(func() (int, error) {
+			return ii, nil
+		})
+	}
+	res, err := pl.Wait()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(res) != 10 {
+		t.Errorf("%v results, want 10", len(res))
+	}
+
+	pl = NewPipeline(NewTyped[int](3), NewTyped[string](2), func(v int) (string, error) {
+		return "", errors.New("my test err")
+	})
+	for i := 0; i < 10; i++ {
+		ii := i
+		pl.Submit(func() (int, error) {
+			time.Sleep(time.Duration(ii) * time.Millisecond)
+			return ii, nil
+		})
+	}
+	if _, err := pl.Wait(); err == nil || !strings.Contains(err.Error(), "my test err") {
+		t.Errorf("Wait() = %v, want the downstream error", err)
+	}
+	fmt.Println("down")
+}
+
+// Panic when submitting to a closed pool
+func TestWorkerPoolMustDo(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	wp.MustDo(func() error {
+		return nil
+	})
+	wp.Wait()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("MustDo on a closed pool did not panic")
+		}
+		fmt.Println("down")
+	}()
+	wp.MustDo(func() error {
+		return nil
+	})
+}
+
+// Queue length and capacity
+func TestWorkerPoolLenCap(t *testing.T) {
+	wp := New(1, WithQueueSize(5)) // Set the maximum number of threads
+	if wp.Cap() != 5 {
+		t.Errorf("Cap() = %v, want 5", wp.Cap())
+	}
+	wp.Pause()
+	for i := 0; i < 3; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	if wp.Len() != 3 {
+		t.Errorf("Len() = %v, want 3", wp.Len())
+	}
+	wp.Resume()
+	wp.Wait()
+	if wp.Len() != 0 {
+		t.Errorf("Len() = %v after Wait", wp.Len())
+	}
+	fmt.Println("down")
+}
+
+// Count failures by reason
+func TestWorkerPoolFailureStats(t *testing.T) {
+	wp := New(3, WithCollectErrors(), WithTimeout(5*time.Millisecond)) // Set the maximum number of threads
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+	wp.Do(func() error {
+		panic("my test panic")
+	})
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	wp.Do(func() error {
+		return nil
+	})
+	wp.Wait()
+
+	st := wp.Stats()
+	if st.Failed != 3 || st.Panics != 1 || st.Timeouts != 1 || st.Completed != 1 {
+		t.Errorf("stats = %+v, want 3 failed, 1 panic, 1 timeout, 1 completed", st)
+	}
+	fmt.Println("down")
+}
+
+// Submit a function with its arguments
+func TestWorkerPoolDoArgs(t *testing.T) {
+	wp := New(3) // Set the maximum number of threads
+	var sum int64
+	add := func(args ...interface{}) error {
+		for _, a := range args {
+			atomic.AddInt64(&sum, int64(a.(int)))
+		}
+		return nil
+	}
+	for i := 0; i < 5; i++ {
+		wp.DoArgs(add, i, 1)
+	}
+	for i := 0; i < 5; i++ {
+		DoFunc1(wp, func(n int64) error {
+			atomic.AddInt64(&sum, n)
+			return nil
+		}, 100)
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if sum != 515 {
+		t.Errorf("sum = %v, want 515", sum)
+	}
+	fmt.Println("down")
+}
+
+// Start tasks in submission order
+func TestWorkerPoolFIFO(t *testing.T) {
+	wp := New(4, WithFIFO()) // Set the maximum number of threads
+	var mu sync.Mutex
+	var order []int
+	for i := 0; i < 50; i++ {
+		ii := i
+		wp.Do(func() error {
+			mu.Lock()
+			order = append(order, ii)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	for i, v := range order {
+		if v != i {
+			t.Errorf("task %v started at position %v", v, i)
+			break
+		}
+	}
+	fmt.Println("down")
+}
+
+// Warn about tasks running longer than a threshold
+func TestWorkerPoolSlowTask(t *testing.T) {
+	var mu sync.Mutex
+	slow := map[string]time.Duration{}
+	wp := New(2, WithSlowTaskThreshold(5*time.Millisecond, func(id string, running time.Duration) {
+		mu.Lock()
+		slow[id] = running
+		mu.Unlock()
+	})) // Set the maximum number of threads
+	wp.DoWithID("slow", func() error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	wp.DoWithID("fast", func() error {
+		return nil
+	})
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := slow["fast"]; ok {
+		t.Error("fast task reported")
+	}
+	if slow["slow"] < 5*time.Millisecond {
+		t.Errorf("slow task reported after %v", slow["slow"])
+	}
+	fmt.Println("down")
+}
+
+// Give up a blocked submission with a context
+func TestWorkerPoolSubmitContext(t *testing.T) {
+	wp := New(1, WithQueueSize(1), WithBlockWhenFull(true)) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	for wp.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 2; i++ { // one held by the dispatcher, one fills the queue
+		wp.Do(func() error {
+			return nil
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := wp.SubmitContext(ctx, func() error {
+		return nil
+	}); err != context.DeadlineExceeded {
+		t.Errorf("SubmitContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	if err := wp.SubmitContext(context.Background(), func() error {
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// Keep every error of many concurrent failing tasks
+func TestWorkerPoolCollectManyErrors(t *testing.T) {
+	wp := New(8, WithCollectErrors()) // Set the maximum number of threads
+	const n = 1000
+	for i := 0; i < n; i++ {
+		ii := i
+		wp.Do(func() error {
+			return fmt.Errorf("my test err %v", ii)
+		})
+	}
+
+	errs := wp.WaitAll()
+	if len(errs) != n {
+		t.Fatalf("WaitAll() returned %v errors, want %v", len(errs), n)
+	}
+	seen := make(map[string]bool, n)
+	for _, err := range errs {
+		seen[err.Error()] = true
+	}
+	for i := 0; i < n; i++ {
+		if !seen[fmt.Sprintf("my test err %v", i)] {
+			t.Errorf("error %v lost", i)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Hold several worker slots with a heavy task
+func TestWorkerPoolDoWeighted(t *testing.T) {
+	wp := New(4) // Set the maximum number of threads
+	var used, peak int32
+	run := func(w int32) TaskHandler {
+		return func() error {
+			n := atomic.AddInt32(&used, w)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&used, -w)
+			return nil
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if i%5 == 0 {
+			if err := wp.DoWeighted(run(3), 3); err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+		wp.Do(run(1))
+	}
+	if err := wp.DoWeighted(run(5), 5); err != ErrWeightTooLarge {
+		t.Errorf("DoWeighted(5) = %v, want %v", err, ErrWeightTooLarge)
+	}
+
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if peak > 4 {
+		t.Errorf("%v slots used at once, want at most 4", peak)
+	}
+	fmt.Println("down")
+}
+
+// Count finished tasks, again from zero after Reset
+func TestWorkerPoolTaskCounters(t *testing.T) {
+	wp := New(2, WithCollectErrors()) // Set the maximum number of threads
+	for i := 0; i < 10; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii < 3 {
+				return errors.New("my test err")
+			}
+			return nil
+		})
+	}
+	wp.Wait()
+	if wp.CompletedTasks() != 7 || wp.FailedTasks() != 3 {
+		t.Errorf("%v completed, %v failed, want 7 and 3", wp.CompletedTasks(), wp.FailedTasks())
+	}
+
+	if err := wp.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if wp.CompletedTasks() != 0 || wp.FailedTasks() != 0 {
+		t.Error("counters not reset")
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Buffer the error stream and drop errors once it is full
+func TestWorkerPoolErrorOverflow(t *testing.T) {
+	for _, tc := range []struct {
+		policy ErrorOverflow
+		want   string
+	}{
+		{ErrorBlock, "0,1,2,3,4"},
+		{ErrorDropNewest, "0,1"},
+		{ErrorDropOldest, "3,4"},
+	} {
+		size := 2
+		if tc.policy == ErrorBlock {
+			size = 5 // large enough for every error, nobody reads before Wait
+		}
+		wp := New(1, WithCollectErrors(), WithErrorBuffer(size), WithErrorOverflow(tc.policy)) // Set the maximum number of threads
+		errc := wp.Errors()
+		for i := 0; i < 5; i++ {
+			ii := i
+			wp.Do(func() error {
+				return fmt.Errorf("%v", ii)
+			})
+		}
+		if errs := wp.WaitAll(); len(errs) != 5 {
+			t.Errorf("policy %v: WaitAll() returned %v errors, want 5", tc.policy, len(errs))
+		}
+		var got []string
+		for err := range errc {
+			got = append(got, err.Error())
+		}
+		if s := strings.Join(got, ","); s != tc.want {
+			t.Errorf("policy %v: streamed %v, want %v", tc.policy, s, tc.want)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Submit from many producers while another goroutine waits
+func TestWorkerPoolProducersRaceWait(t *testing.T) {
+	for round := 0; round < 10; round++ {
+		wp := New(4) // Set the maximum number of threads
+		var accepted, ran int64
+		var producers sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			producers.Add(1)
+			go func() {
+				defer producers.Done()
+				for n := 0; n < 200; n++ {
+					err := wp.Do(func() error {
+						atomic.AddInt64(&ran, 1)
+						return nil
+					})
+					if err != nil {
+						if err != ErrPoolClosed {
+							t.Error(err)
+						}
+						return
+					}
+					atomic.AddInt64(&accepted, 1)
+				}
+			}()
+		}
+		if err := wp.Wait(); err != nil {
+			t.Error(err)
+		}
+		producers.Wait()
+		if accepted != ran {
+			t.Errorf("%v tasks accepted, %v ran", accepted, ran)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Run a side effect over items and stop on the first error
+func TestWorkerPoolForEach(t *testing.T) {
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	var sum int64
+	if err := ForEach(4, items, func(v int) error {
+		atomic.AddInt64(&sum, int64(v))
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+	if sum != 4950 {
+		t.Errorf("sum = %v, want 4950", sum)
+	}
+
+	var count int32
+	err := ForEach(2, items, func(v int) error {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond)
+		if v == 3 {
+			return errors.New("my test err")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("ForEach() = nil, want the error")
+	}
+	if n := atomic.LoadInt32(&count); n == 100 {
+		t.Errorf("%v items ran after the error", n)
+	}
+	fmt.Println("down")
+}
+
+// Run every task at once without a concurrency cap
+func TestWorkerPoolUnbounded(t *testing.T) {
+	wp := New(Unbounded) // Set the maximum number of threads
+	const n = 50
+	var started sync.WaitGroup
+	started.Add(n)
+	release := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wp.Do(func() error {
+			started.Done()
+			<-release
+			return nil
+		})
+	}
+	started.Wait() // every task runs at the same time
+	if r := wp.Running(); r != n {
+		t.Errorf("Running() = %v, want %v", r, n)
+	}
+	close(release)
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// Run callbacks as worker goroutines start and stop
+func TestWorkerPoolWorkerCallbacks(t *testing.T) {
+	var mu sync.Mutex
+	alive := map[int]bool{}
+	var starts int
+	wp := New(3, WithOnWorkerStart(func(id int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if alive[id] {
+			t.Errorf("worker %v started twice", id)
+		}
+		alive[id] = true
+		starts++
+	}), WithOnWorkerStop(func(id int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !alive[id] {
+			t.Errorf("worker %v stopped before it started", id)
+		}
+		delete(alive, id)
+	})) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		wp.Do(func() error {
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if starts == 0 || starts > 3 {
+		t.Errorf("%v workers started, want 1 to 3", starts)
+	}
+	if len(alive) != 0 {
+		t.Errorf("%v workers not stopped after Wait", len(alive))
+	}
+	fmt.Println("down")
+}
+
+// Hand each worker its own value
+func TestWorkerPoolWorkerValue(t *testing.T) {
+	var opened, closed int32
+	var wp *WorkPool
+	wp = New(3, WithWorkerValue(func(id int) interface{} {
+		atomic.AddInt32(&opened, 1)
+		return id
+	}, func(v interface{}) {
+		atomic.AddInt32(&closed, 1)
+	})) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		wp.DoContext(func(ctx context.Context) error {
+			if _, ok := wp.WorkerValue(ctx).(int); !ok {
+				return errors.New("no worker value")
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	if opened == 0 || opened != closed {
+		t.Errorf("%v values opened, %v closed", opened, closed)
+	}
+	if v := wp.WorkerValue(context.Background()); v != nil {
+		t.Errorf("WorkerValue outside a task = %v", v)
+	}
+	fmt.Println("down")
+}
+
+// Cancel before Wait cancels the pool, Cancel after Wait changes nothing
+func TestWorkerPoolCancelWait(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	wp.Do(func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	wp.Cancel()
+	wp.Cancel()
+	if err := wp.Wait(); err != ErrPoolCanceled {
+		t.Errorf("Cancel then Wait = %v, want %v", err, ErrPoolCanceled)
+	}
+
+	wp = New(2) // Set the maximum number of threads
+	wp.Do(func() error {
+		return nil
+	})
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	wp.Cancel()
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait after Cancel = %v, want nil", err)
+	}
+	if err := wp.Reset(); err != nil {
+		t.Error(err)
+	}
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait after Reset = %v, want nil", err)
+	}
+	fmt.Println("down")
+}
+
+// Select on the end of the pool
+func TestWorkerPoolDone(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	wp.Do(func() error {
+		return nil
+	})
+	select {
+	case <-wp.Done():
+		t.Error("Done closed before Wait")
+	default:
+	}
+	go wp.Wait()
+	select {
+	case <-wp.Done():
+	case <-time.After(time.Second):
+		t.Error("Done not closed after Wait")
+	}
+
+	wp = New(2) // Set the maximum number of threads
+	wp.Do(func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	wp.Cancel()
+	select {
+	case <-wp.Done():
+	case <-time.After(time.Second):
+		t.Error("Done not closed after Cancel")
+	}
+	if err := wp.Wait(); err != ErrPoolCanceled {
+		t.Errorf("Wait() = %v, want %v", err, ErrPoolCanceled)
+	}
+	fmt.Println("down")
+}
+
+// Handle a task panic as an error, ignore it or raise it again in Wait
+func TestWorkerPoolPanicPolicy(t *testing.T) {
+	panicking := func() error {
+		panic("my test panic")
+	}
+
+	wp := New(2, WithPanicPolicy(PanicAsError)) // Set the maximum number of threads
+	wp.Do(panicking)
+	if err := wp.Wait(); err == nil || !strings.Contains(err.Error(), "my test panic") {
+		t.Errorf("PanicAsError: Wait() = %v, want the panic", err)
+	}
+
+	wp = New(2, WithPanicPolicy(PanicIgnore)) // Set the maximum number of threads
+	wp.Do(panicking)
+	if err := wp.Wait(); err != nil {
+		t.Errorf("PanicIgnore: Wait() = %v, want nil", err)
+	}
+	if st := wp.Stats(); st.Panics != 1 || st.Completed != 1 {
+		t.Errorf("PanicIgnore: stats = %+v", st)
+	}
+
+	wp = New(2, WithPanicPolicy(PanicCrash)) // Set the maximum number of threads
+	wp.Do(panicking)
+	func() {
+		defer func() {
+			r := recover()
+			if s, _ := r.(string); !strings.Contains(s, "my test panic") {
+				t.Errorf("PanicCrash: Wait panicked with %v", r)
+			}
+		}()
+		wp.Wait()
+		t.Error("PanicCrash: Wait did not panic")
+	}()
+	fmt.Println("down")
+}
+
+// Run a batch and report every error by position
+func TestWorkerPoolSubmitAll(t *testing.T) {
+	wp := New(3) // Set the maximum number of threads
+	fns := make([]TaskHandler, 10)
+	for i := range fns {
+		ii := i
+		fns[i] = func() error {
+			if ii%3 == 0 {
+				return fmt.Errorf("my test err %v", ii)
+			}
+			return nil
+		}
+	}
+
+	errs := wp.SubmitAll(fns)
+	for i, err := range errs {
+		if i%3 == 0 && (err == nil || err.Error() != fmt.Sprintf("my test err %v", i)) {
+			t.Errorf("errs[%v] = %v", i, err)
+		}
+		if i%3 != 0 && err != nil {
+			t.Errorf("errs[%v] = %v, want nil", i, err)
+		}
+	}
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait() = %v, the batch errors should not reach it", err)
+	}
+	fmt.Println("down")
+}
+
+// Stop waiting for a task when the caller's context is done
+func TestWorkerPoolDoWaitContext(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	if err := wp.DoWaitContext(context.Background(), func(ctx context.Context) error {
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	canceled := make(chan struct{})
+	if err := wp.DoWaitContext(ctx, func(tctx context.Context) error {
+		<-tctx.Done()
+		close(canceled)
+		return tctx.Err()
+	}); err != context.DeadlineExceeded {
+		t.Errorf("DoWaitContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("task context not canceled")
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// Stream results from a channel of items
+func TestWorkerPoolMapStream(t *testing.T) {
+	items := make(chan int)
+	go func() {
+		defer close(items)
+		for i := 0; i < 100; i++ {
+			items <- i
+		}
+	}()
+	var sum, n int
+	for r := range MapStream(4, items, func(v int) (int, error) {
+		return v * 2, nil
+	}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+		if r.Value != 2*r.Seq {
+			t.Errorf("result %v has Seq %v", r.Value, r.Seq)
+		}
+		sum += r.Value
+		n++
+	}
+	if n != 100 || sum != 9900 {
+		t.Errorf("%v results, sum %v, want 100 and 9900", n, sum)
+	}
+
+	items = make(chan int) // never closed, the error stops reading
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case items <- i:
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}()
+	var last Result[int]
+	for r := range MapStream(2, items, func(v int) (int, error) {
+		if v == 10 {
+			return 0, errors.New("my test err")
+		}
+		return v, nil
+	}) {
+		last = r
+	}
+	if last.Err == nil || last.Seq != -1 {
+		t.Errorf("last result %+v, want the error with Seq -1", last)
+	}
+	fmt.Println("down")
+}
+
+// Retry only the errors accepted by the policy
+func TestWorkerPoolDoRetryPolicy(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    4 * time.Millisecond,
+		Jitter:      0.5,
+		RetryIf: func(err error) bool {
+			return err == errTransient
+		},
+	}
+
+	wp := New(2, WithCollectErrors()) // Set the maximum number of threads
+	var transient, permanent int32
+	wp.DoRetryPolicy(func() error {
+		if atomic.AddInt32(&transient, 1) < 3 {
+			return errTransient
+		}
+		return nil
+	}, policy)
+	wp.DoRetryPolicy(func() error {
+		atomic.AddInt32(&permanent, 1)
+		return errPermanent
+	}, policy)
+	errs := wp.WaitAll()
+
+	if transient != 3 {
+		t.Errorf("transient error tried %v times, want 3", transient)
+	}
+	if permanent != 1 {
+		t.Errorf("permanent error tried %v times, want 1", permanent)
+	}
+	if len(errs) != 1 || errs[0] != errPermanent {
+		t.Errorf("WaitAll() = %v, want the permanent error", errs)
+	}
+	for retry := 1; retry < 10; retry++ {
+		if d := policy.delay(retry); d > policy.MaxDelay || d < 0 {
+			t.Errorf("delay(%v) = %v", retry, d)
+		}
+	}
+	fmt.Println("down")
+}
+
+// Read the configured number of workers
+func TestWorkerPoolMaxWorkers(t *testing.T) {
+	wp := New(3) // Set the maximum number of threads
+	if wp.MaxWorkers() != 3 {
+		t.Errorf("MaxWorkers() = %v, want 3", wp.MaxWorkers())
+	}
+	wp.Resize(5)
+	if wp.MaxWorkers() != 5 {
+		t.Errorf("MaxWorkers() = %v after Resize(5)", wp.MaxWorkers())
+	}
+	wp.Wait()
+
+	wp = New(Unbounded) // Set the maximum number of threads
+	if wp.MaxWorkers() != 0 {
+		t.Error("unbounded pool has a max")
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Stream the lifecycle events of the pool
+func TestWorkerPoolEvents(t *testing.T) {
+	wp := New(2, WithCollectErrors(), WithTimeout(5*time.Millisecond)) // Set the maximum number of threads
+	events := wp.Events()
+	wp.DoWithID("ok", func() error {
+		return nil
+	})
+	wp.DoWithID("bad", func() error {
+		return errors.New("my test err")
+	})
+	wp.DoWithID("slow", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	wp.Wait()
+
+	got := map[EventType]int{}
+	for e := range events {
+		if e.Time.IsZero() {
+			t.Errorf("event %v without time", e.Type)
+		}
+		if e.Type == TaskFailed && e.TaskID != "bad" {
+			t.Errorf("TaskFailed for %q", e.TaskID)
+		}
+		got[e.Type]++
+	}
+	if got[TaskSubmitted] != 3 || got[TaskStarted] != 3 || got[TaskCompleted] != 1 || got[TaskFailed] != 1 || got[TaskTimedOut] != 1 {
+		t.Errorf("events = %v", got)
+	}
+	if got[WorkerStarted] == 0 || got[WorkerStarted] != got[WorkerStopped] {
+		t.Errorf("%v workers started, %v stopped", got[WorkerStarted], got[WorkerStopped])
+	}
+	fmt.Println("down")
+}
+
+// Barrier waits for the tasks submitted before it only
+func TestWorkerPoolBarrier(t *testing.T) {
+	wp := New(4) // Set the maximum number of threads
+	select {
+	case <-wp.Barrier():
+	case <-time.After(time.Second):
+		t.Fatal("barrier of an idle pool not closed")
+	}
+
+	var first int32
+	for i := 0; i < 10; i++ {
+		wp.Do(func() error {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&first, 1)
+			return nil
+		})
+	}
+	b1 := wp.Barrier()
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	b2 := wp.Barrier()
+
+	<-b1
+	if n := atomic.LoadInt32(&first); n != 10 {
+		t.Errorf("%v tasks finished at the barrier, want 10", n)
+	}
+	select {
+	case <-b2:
+		t.Error("second barrier closed before its task finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-b2
+	if wp.IsClosed() {
+		t.Error("pool closed by Barrier")
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Submissions are refused once a task error tripped fail-fast
+func TestWorkerPoolSubmitAfterFailure(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+	<-wp.ctx.Done() // tripped. 已触发快速失败
+
+	if err := wp.Do(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("Do() = %v, want ErrPoolClosed", err)
+	}
+	if err := wp.Submit(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("Submit() = %v, want ErrPoolClosed", err)
+	}
+	if wp.TrySubmit(func() error { return nil }) {
+		t.Error("TrySubmit() accepted a task")
+	}
+	if err := wp.Wait(); err == nil || !strings.Contains(err.Error(), "my test err") {
+		t.Errorf("Wait() = %v, want the task error", err)
+	}
+	fmt.Println("down")
+}
+
+// TryDoWait refuses a task once the pool is saturated or closed
+func TestWorkerPoolTryDoWait(t *testing.T) {
+	wp := New(1, WithQueueSize(0)) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	for wp.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err, ok := wp.TryDoWait(func() error { return nil }, time.Second); ok || err != ErrQueueFull {
+		t.Errorf("TryDoWait() = %v, %v on a saturated pool, want ErrQueueFull, false", err, ok)
+	}
+	close(release)
+	for wp.Running() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err, ok := wp.TryDoWait(func() error {
+		return errors.New("my test err")
+	}, time.Second); !ok || err == nil || err.Error() != "my test err" {
+		t.Errorf("TryDoWait() = %v, %v, want my test err, true", err, ok)
+	}
+	wp.Wait()
+	if _, ok := wp.TryDoWait(func() error { return nil }, time.Second); ok {
+		t.Error("TryDoWait() accepted a task on a closed pool")
+	}
+	fmt.Println("down")
+}
+
+// Acquire borrows worker slots from the pool
+func TestWorkerPoolAcquire(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := wp.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := wp.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Acquire() = %v, want context.DeadlineExceeded", err)
+	}
+	var ran int32
+	wp.Do(func() error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&ran) == 1 {
+		t.Error("task ran while every slot was borrowed")
+	}
+
+	releases[0]()
+	releases[0]() // no effect. 重复调用无影响
+	for atomic.LoadInt32(&ran) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	releases[1]()
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// SubmitWait returns the error of its own task only
+func TestWorkerPoolSubmitWait(t *testing.T) {
+	wp := New(2, WithCollectErrors()) // Set the maximum number of threads
+	wp.Do(func() error {
+		return errors.New("other err")
+	})
+	if err := wp.SubmitWait(func() error { return nil }); err != nil {
+		t.Errorf("SubmitWait() = %v, want nil", err)
+	}
+	if err := wp.SubmitWait(func() error {
+		return errors.New("my test err")
+	}); err == nil || err.Error() != "my test err" {
+		t.Errorf("SubmitWait() = %v, want my test err", err)
+	}
+	wp.Wait()
+	if err := wp.SubmitWait(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("SubmitWait() after Wait = %v, want %v", err, ErrPoolClosed)
+	}
+	fmt.Println("down")
+}
+
+type captureLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *captureLogger) Error(a ...interface{}) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, fmt.Sprint(a...))
+	l.mu.Unlock()
+}
+
+func (l *captureLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.msgs...)
+}
+
+// The deadlock detector dumps the stacks once the busy pool stops making progress
+func TestWorkerPoolDeadlockDetector(t *testing.T) {
+	logger := &captureLogger{}
+	wp := New(1, WithLogger(logger), WithDeadlockDetector(5*time.Millisecond)) // Set the maximum number of threads
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		wp.Do(func() error {
+			<-release
+			return nil
+		})
+	}
+	time.Sleep(40 * time.Millisecond)
+	close(release)
+	wp.Wait()
+
+	msgs := logger.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("logged %v dumps, want 1", len(msgs))
+	}
+	if !strings.Contains(msgs[0], "possible deadlock") || !strings.Contains(msgs[0], "TestWorkerPoolDeadlockDetector") {
+		t.Errorf("dump without the stacks: %.200s", msgs[0])
+	}
+
+	// Reset while the watchdog of the last run still ticks, see go test -race. 上一轮的检测仍在运行时重置
+	wp = New(2, WithDeadlockDetector(time.Millisecond)) // Set the maximum number of threads
+	for i := 0; i < 20; i++ {
+		wp.Wait()
+		wp.Reset()
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// The submission context is the parent of the task context
+func TestWorkerPoolDoWithContext(t *testing.T) {
+	type traceKey struct{}
+	wp := New(2, WithTimeout(time.Second)) // Set the maximum number of threads
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), traceKey{}, "trace-1"))
+	started := make(chan struct{})
+	var got interface{}
+	var hasDeadline bool
+	var taskErr error
+	wp.DoWithContext(ctx, func(tctx context.Context) error {
+		got = tctx.Value(traceKey{})
+		_, hasDeadline = tctx.Deadline()
+		close(started)
+		<-tctx.Done()
+		taskErr = tctx.Err()
+		return taskErr
+	})
+	<-started
+	cancel()
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait() = %v, the caller's cancellation is not a pool error", err)
+	}
+	if got != "trace-1" || !hasDeadline {
+		t.Errorf("task context value %v, deadline %v, want trace-1 and the pool timeout", got, hasDeadline)
+	}
+	if taskErr != context.Canceled {
+		t.Errorf("task context error %v, want context.Canceled", taskErr)
+	}
+	wp = New(1) // Set the maximum number of threads
+	if err := wp.DoWithContext(ctx, func(context.Context) error { return nil }); err != context.Canceled {
+		t.Errorf("DoWithContext() = %v with a done ctx, want context.Canceled", err)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// A full Results buffer blocks or drops as set by WithResultOverflow
+func TestPoolResultOverflow(t *testing.T) {
+	for _, tc := range []struct {
+		policy ResultOverflow
+		want   string
+	}{
+		{ResultBlock, "0,1,2,3,4"},
+		{ResultDropNewest, "0,1"},
+		{ResultDropOldest, "3,4"},
+	} {
+		size := 2
+		if tc.policy == ResultBlock {
+			size = 5 // large enough for every result, nobody reads before Wait
+		}
+		p := NewTyped[int](1, WithResultBuffer(size), WithResultOverflow(tc.policy)) // Set the maximum number of threads
+		results := p.Results()
+		for i := 0; i < 5; i++ {
+			ii := i
+			p.Submit(func() (int, error) {
+				return ii, nil
+			})
+		}
+		if values, err := p.Wait(); err != nil || len(values) != 5 {
+			t.Errorf("policy %v: Wait() = %v, %v, want 5 values", tc.policy, values, err)
+		}
+		var got []string
+		for r := range results {
+			got = append(got, fmt.Sprint(r.Value))
+		}
+		if s := strings.Join(got, ","); s != tc.want {
+			t.Errorf("policy %v: streamed %v, want %v", tc.policy, s, tc.want)
+		}
+	}
+	fmt.Println("down")
+}
+
+// WaitIdle returns the errors so far and keeps the pool open
+func TestWorkerPoolWaitIdle(t *testing.T) {
+	wp := New(3, WithCollectErrors()) // Set the maximum number of threads
+	var count int32
+	for i := 0; i < 10; i++ {
+		wp.Do(func() error {
+			time.Sleep(1 * time.Millisecond)
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+	if err := wp.WaitIdle(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&count); n != 10 {
+		t.Errorf("%v tasks finished after WaitIdle, want 10", n)
+	}
+
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+	if err := wp.WaitIdle(); err == nil || err.Error() != "my test err" {
+		t.Errorf("WaitIdle() = %v, want my test err", err)
+	}
+	if err := wp.Do(func() error { return nil }); err != nil {
+		t.Errorf("Do() after WaitIdle = %v", err)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Workers started together spread their first tasks over the stagger window
+func TestWorkerPoolStartupStagger(t *testing.T) {
+	const stagger = 30 * time.Millisecond
+	wp := New(8, WithStartupStagger(stagger)) // Set the maximum number of threads
+	start := time.Now()
+	var mu sync.Mutex
+	var first, last time.Duration
+	for i := 0; i < 8; i++ {
+		wp.Do(func() error {
+			d := time.Since(start)
+			mu.Lock()
+			if first == 0 || d < first {
+				first = d
+			}
+			if d > last {
+				last = d
+			}
+			mu.Unlock()
+			time.Sleep(stagger) // keep every worker busy. 占住worker
+			return nil
+		})
+	}
+	wp.Drain()
+	if last-first < 2*time.Millisecond || last > 2*stagger {
+		t.Errorf("first tasks started between %v and %v, want spread within %v", first, last, stagger)
+	}
+
+	begin := time.Now()
+	wp.DoWait(func() error { return nil })
+	if d := time.Since(begin); d >= stagger {
+		t.Errorf("task after the startup window waited %v", d)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// CloseNow discards the queue and lets the running task finish
+func TestWorkerPoolCloseNow(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	started, release := make(chan struct{}), make(chan struct{})
+	var taskErr error
+	wp.DoContext(func(ctx context.Context) error {
+		close(started)
+		<-release
+		taskErr = ctx.Err()
+		return errors.New("my test err")
+	})
+	<-started
+	var ran int32
+	for i := 0; i < 5; i++ {
+		wp.Do(func() error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		})
+	}
+
+	res := make(chan error, 1)
+	go func() {
+		res <- wp.CloseNow()
+	}()
+	for !wp.IsClosed() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := wp.Do(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("Do() during CloseNow = %v, want ErrPoolClosed", err)
+	}
+	close(release)
+	if err := <-res; err == nil || err.Error() != "my test err" {
+		t.Errorf("CloseNow() = %v, want my test err", err)
+	}
+	if taskErr != nil {
+		t.Errorf("running task context canceled: %v", taskErr)
+	}
+	if n := atomic.LoadInt32(&ran); n != 0 {
+		t.Errorf("%v queued tasks ran, want 0", n)
+	}
+	fmt.Println("down")
+}
+
+// The pool name prefixes the logs and shows up in Stats and Events
+func TestWorkerPoolName(t *testing.T) {
+	logger := &captureLogger{}
+	wp := New(1, WithName("orders"), WithLogger(logger)) // Set the maximum number of threads
+	events := wp.Events()
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+	wp.Wait()
+
+	if msgs := logger.messages(); len(msgs) != 1 || msgs[0] != "workpool orders: my test err" {
+		t.Errorf("logged %q, want the pool name first", msgs)
+	}
+	if name := wp.Stats().Name; name != "orders" {
+		t.Errorf("Stats().Name = %q, want orders", name)
+	}
+	for e := range events {
+		if e.Pool != "orders" {
+			t.Errorf("event %v from pool %q, want orders", e.Type, e.Pool)
+		}
+	}
+	fmt.Println("down")
+}
+
+// WaitAny returns on the first success and cancels the other tasks
+func TestWorkerPoolWaitAny(t *testing.T) {
+	wp := New(3, WithCollectErrors()) // Set the maximum number of threads
+	var canceled int32
+	for i := 0; i < 2; i++ {
+		wp.DoContext(func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				atomic.AddInt32(&canceled, 1)
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		})
+	}
+	wp.Do(func() error {
+		time.Sleep(1 * time.Millisecond)
+		return nil
+	})
+	begin := time.Now()
+	if err := wp.WaitAny(); err != nil {
+		t.Errorf("WaitAny() = %v, want nil", err)
+	}
+	if d := time.Since(begin); d >= time.Second {
+		t.Errorf("WaitAny() took %v", d)
+	}
+	<-wp.Done()
+	if n := atomic.LoadInt32(&canceled); n != 2 {
+		t.Errorf("%v slower tasks canceled, want 2", n)
+	}
+
+	wp = New(3, WithCollectErrors()) // Set the maximum number of threads
+	for i := 0; i < 3; i++ {
+		wp.Do(func() error {
+			return errors.New("my test err")
+		})
+	}
+	if err := wp.WaitAny(); err == nil || !strings.Contains(err.Error(), "my test err") {
+		t.Errorf("WaitAny() = %v, want the task errors", err)
+	}
+	fmt.Println("down")
+}
+
+// The ring buffer queue keeps the submission order and grows once full
+func TestWorkerPoolRingBuffer(t *testing.T) {
+	wp := New(1, WithRingBuffer(2), WithFIFO()) // Set the maximum number of threads
+	wp.Pause()
+	var mu sync.Mutex
+	var order []int
+	for i := 0; i < 20; i++ {
+		ii := i
+		wp.DoPriority(func() error { // priorities are ignored. 忽略优先级
+			mu.Lock()
+			order = append(order, ii)
+			mu.Unlock()
+			return nil
+		}, ii)
+	}
+	wp.Resume()
+	wp.Wait()
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("order %v, want submission order", order)
+		}
+	}
+	if len(order) != 20 {
+		t.Errorf("%v tasks ran, want 20", len(order))
+	}
+	fmt.Println("down")
+}
+
+// Tiny tasks through the default heap queue
+func BenchmarkWorkPoolHeapQueue(b *testing.B) {
+	wp := New(8) // Set the maximum number of threads
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	wp.Wait()
+}
+
+// Tiny tasks through the ring buffer queue
+func BenchmarkWorkPoolRingBuffer(b *testing.B) {
+	wp := New(8, WithRingBuffer(1024)) // Set the maximum number of threads
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	wp.Wait()
+}
+
+// LastActivity moves when tasks start and finish
+func TestWorkerPoolLastActivity(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	if at := wp.LastActivity(); !at.IsZero() {
+		t.Errorf("LastActivity() = %v before any task, want zero", at)
+	}
+	begin := time.Now()
+	wp.Do(func() error {
+		time.Sleep(1 * time.Millisecond)
+		return nil
+	})
+	wp.WaitN(1)
+	at := wp.LastActivity()
+	if at.Before(begin) || at.After(time.Now()) || at.Sub(begin) < time.Millisecond {
+		t.Errorf("LastActivity() = %v, want the end of the task started at %v", at, begin)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// A task reschedules itself on a full blocking queue without deadlock
+func TestWorkerPoolResubmit(t *testing.T) {
+	wp := New(1, WithQueueSize(1), WithBlockWhenFull(true)) // Set the maximum number of threads
+	var count int32
+	var task func(depth int) TaskHandler
+	task = func(depth int) TaskHandler {
+		return func() error {
+			atomic.AddInt32(&count, 1)
+			if depth == 3 {
+				return nil
+			}
+			for i := 0; i < 2; i++ { // more than the queue holds. 超过队列容量
+				if err := wp.Resubmit(task(depth + 1)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	wp.Do(task(0))
+	if err := wp.WaitTimeout(time.Second); err != nil {
+		t.Fatalf("WaitTimeout() = %v", err)
+	}
+	if n := atomic.LoadInt32(&count); n != 15 {
+		t.Errorf("%v tasks ran, want 15", n)
+	}
+	fmt.Println("down")
+}
+
+// Without fail-fast Wait returns every error as a MultiError
+func TestWorkerPoolMultiError(t *testing.T) {
+	wp := New(1, WithCollectErrors()) // Set the maximum number of threads
+	for i := 0; i < 5; i++ {
+		ii := i
+		wp.Do(func() error {
+			return fmt.Errorf("err %v", ii)
+		})
+	}
+	err := wp.Wait()
+	multi, ok := err.(*MultiError)
+	if !ok {
+		t.Fatalf("Wait() = %T, want *MultiError", err)
+	}
+	if n := len(multi.Errors()); n != 5 || len(multi.Unwrap()) != 5 {
+		t.Errorf("%v errors, want 5", n)
+	}
+	if s := multi.Error(); s != "5 errors: err 0; err 1; err 2; and 2 more" {
+		t.Errorf("Error() = %q", s)
+	}
+
+	wp = New(1, WithCollectErrors()) // Set the maximum number of threads
+	wp.Do(func() error {
+		return errors.New("my test err")
+	})
+	if err := wp.Wait(); err == nil || err.Error() != "my test err" {
+		t.Errorf("Wait() = %v, want my test err alone", err)
+	}
+	fmt.Println("down")
+}
+
+// WaitProgress reports the finished and submitted counts until done
+func TestWorkerPoolWaitProgress(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	for i := 0; i < 10; i++ {
+		wp.Do(func() error {
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		})
+	}
+	var calls, lastDone, lastTotal int
+	err := wp.WaitProgress(func(done, total int) {
+		calls++
+		if done < lastDone {
+			t.Errorf("done went back from %v to %v", lastDone, done)
+		}
+		lastDone, lastTotal = done, total
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if calls < 2 || lastDone != 10 || lastTotal != 10 {
+		t.Errorf("%v calls ending with %v/%v, want progress up to 10/10", calls, lastDone, lastTotal)
+	}
+	if n := wp.Stats().Submitted; n != 10 {
+		t.Errorf("Stats().Submitted = %v, want 10", n)
+	}
+
+	// skipped nil tasks and Acquire slots reach the total as well. 忽略的空任务与借用的名额同样计入
+	wp = New(2) // Set the maximum number of threads
+	wp.Do(nil)
+	release, err := wp.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	wp.Do(func() error { return nil })
+	wp.WaitProgress(func(done, total int) {
+		lastDone, lastTotal = done, total
+	})
+	if lastDone != 3 || lastTotal != 3 {
+		t.Errorf("progress ended with %v/%v, want 3/3", lastDone, lastTotal)
+	}
+	fmt.Println("down")
+}
+
+// WithConcurrency caps the running tasks below the number of workers
+func TestWorkerPoolConcurrency(t *testing.T) {
+	wp := New(8, WithConcurrency(3)) // Set the maximum number of threads
+	var running, peak int32
+	for i := 0; i < 20; i++ {
+		wp.Do(func() error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	wp.Wait()
+	if n := atomic.LoadInt32(&peak); n != 3 {
+		t.Errorf("peak = %v, want 3", n)
+	}
+	fmt.Println("down")
+}
+
+// Several tasks failing together: the first error with fail-fast, all of them without
+func TestWorkerPoolConcurrentErrors(t *testing.T) {
+	for _, failFast := range []bool{true, false} {
+		wp := New(4, WithFailFast(failFast)) // Set the maximum number of threads
+		start := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			ii := i
+			wp.Do(func() error {
+				<-start
+				return fmt.Errorf("err %v", ii)
+			})
+		}
+		for wp.Running() < 4 {
+			time.Sleep(time.Millisecond)
+		}
+		close(start)
+		err := wp.Wait()
+		multi, isMulti := err.(*MultiError)
+		if failFast && (err == nil || isMulti) {
+			t.Errorf("fail-fast Wait() = %v, want the first error alone", err)
+		}
+		if !failFast && (!isMulti || len(multi.Errors()) != 4) {
+			t.Errorf("Wait() = %v, want all 4 errors", err)
+		}
+	}
+	fmt.Println("down")
+}
+
+// fakeClock Clock advanced by hand
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	c     chan time.Time
+	f     func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1e9, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, make(chan time.Time, 1), nil)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(d, nil, f)
+}
+
+func (c *fakeClock) add(d time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), c: ch, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance Move the time forward and fire the timers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	now := c.now
+	c.mu.Unlock()
+
+	for _, t := range due {
+		if t.f != nil {
+			go t.f()
+		} else {
+			t.c <- now
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, o := range c.timers {
+		if o == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// The task timeout follows the injected clock, no real sleep
+func TestWorkerPoolClock(t *testing.T) {
+	clock := newFakeClock()
+	wp := New(1, WithClock(clock), WithTimeout(time.Hour), WithSilent()) // Set the maximum number of threads
+	deadline := make(chan time.Time, 1)
+	wp.DoContext(func(ctx context.Context) error {
+		d, _ := ctx.Deadline()
+		deadline <- d
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if d := <-deadline; !d.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("deadline = %v, want one hour after %v", d, clock.Now())
+	}
+
+	clock.Advance(time.Hour)
+	if err, ok := wp.Wait().(*TimeoutError); !ok {
+		t.Errorf("Wait() = %v, want a *TimeoutError", err)
+	}
+	if s := wp.Stats(); s.Timeouts != 1 {
+		t.Errorf("Timeouts = %v, want 1", s.Timeouts)
+	}
+
+	// timed waits too. 带超时的等待同样使用该时钟
+	wp = New(1, WithClock(clock)) // Set the maximum number of threads
+	release := make(chan struct{})
+	res := make(chan error, 1)
+	go func() {
+		res <- wp.DoWaitTimeout(func() error {
+			<-release
+			return nil
+		}, time.Minute)
+	}()
+	for wp.Running() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	if err := <-res; err != ErrWaitTimeout {
+		t.Errorf("DoWaitTimeout() = %v, want ErrWaitTimeout", err)
+	}
+	close(release)
+	wp.Wait()
+
+	// and the retry backoff. 重试间隔同样使用该时钟
+	wp = New(1, WithClock(clock)) // Set the maximum number of threads
+	var attempts int32
+	wp.DoRetry(func() error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return errors.New("my test err")
+		}
+		return nil
+	}, 2, time.Hour)
+	for atomic.LoadInt32(&attempts) < 2 {
+		clock.Advance(time.Hour)
+		time.Sleep(time.Millisecond)
+	}
+	if err := wp.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want the retry to succeed", err)
+	}
+	fmt.Println("down")
+}
+
+// Resize(0) parks the pool: the workers exit, tasks queue up and run after scaling back up
+func TestWorkerPoolResizeZero(t *testing.T) {
+	wp := New(2) // Set the maximum number of threads
+	wp.Warmup()
+	wp.Resize(0)
+	for wp.Stats().Workers > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var n int32
+	for i := 0; i < 4; i++ {
+		wp.Do(func() error {
+			atomic.AddInt32(&n, 1)
+			return nil
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	if v, s := atomic.LoadInt32(&n), wp.Stats(); v != 0 || s.Workers != 0 {
+		t.Errorf("parked: ran %v with %v workers, want none", v, s.Workers)
+	}
+
+	// paused as well, scaling up alone does not run anything. 同时暂停时仅扩容不会执行
+	wp.Pause()
+	wp.Resize(2)
+	time.Sleep(20 * time.Millisecond)
+	if v := atomic.LoadInt32(&n); v != 0 {
+		t.Errorf("paused: ran %v, want 0", v)
+	}
+	wp.Resume()
+	if err := wp.WaitTimeout(time.Second); err != nil {
+		t.Error(err)
+	}
+	if v := atomic.LoadInt32(&n); v != 4 {
+		t.Errorf("ran %v, want 4", v)
+	}
+	fmt.Println("down")
+}
+
+// DoSync returns only once a worker started the task, not when the queue took it
+func TestWorkerPoolDoSync(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	release := make(chan struct{})
+	var running int32
+	if err := wp.DoSync(func() error {
+		atomic.AddInt32(&running, 1)
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if v := atomic.LoadInt32(&running); v != 1 {
+		t.Errorf("running = %v after DoSync, want 1", v)
+	}
+
+	// the only worker is busy, the next one waits for it with free queue space. 唯一的worker忙，即使队列有空位也等待
+	res := make(chan error, 1)
+	go func() {
+		res <- wp.DoSync(func() error { return nil })
+	}()
+	select {
+	case err := <-res:
+		t.Errorf("DoSync() = %v before a worker was free", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-res; err != nil {
+		t.Error(err)
+	}
+	wp.Wait()
+
+	if err := wp.DoSync(func() error { return nil }); err != ErrPoolClosed {
+		t.Errorf("DoSync() after Wait = %v, want ErrPoolClosed", err)
+	}
+	fmt.Println("down")
+}
+
+// A timeout is reported as a *TimeoutError with the task id and the time it was allowed
+func TestWorkerPoolTimeoutError(t *testing.T) {
+	wp := New(1, WithTimeout(5*time.Millisecond), WithSilent()) // Set the maximum number of threads
+	wp.DoWithID("slow", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	err := wp.Wait()
+	if err == nil || err.Error() != "task slow: "+context.DeadlineExceeded.Error() {
+		t.Fatalf("Wait() = %v, want the task id and the timeout", err)
+	}
+	wrapped, _ := err.(interface{ Unwrap() error }) // the task id prefix. 任务标识前缀
+	timeout, ok := wrapped.Unwrap().(*TimeoutError)
+	if !ok || timeout.ID != "slow" || timeout.Duration <= 0 || timeout.Duration > 5*time.Millisecond {
+		t.Errorf("Wait() = %#v, want a *TimeoutError of task slow within 5ms", wrapped.Unwrap())
+	}
+	if timeout.Unwrap() != context.DeadlineExceeded || !timeout.Timeout() {
+		t.Error("a TimeoutError must unwrap to context.DeadlineExceeded")
+	}
+
+	// a task failure stays as it is. 任务自身的错误保持不变
+	wp = New(1, WithTimeout(time.Second)) // Set the maximum number of threads
+	wp.Do(func() error {
+		return context.DeadlineExceeded
+	})
+	if err := wp.Wait(); err != context.DeadlineExceeded {
+		t.Errorf("Wait() = %v, want the error of the task", err)
+	}
+	fmt.Println("down")
+}
+
+// A timed out task returning ctx.Err() is reported once, not again when it returns
+func TestWorkerPoolTimeoutReportedOnce(t *testing.T) {
+	var handled int32
+	wp := New(1, WithTimeout(10*time.Millisecond), WithFailFast(false), WithSilent(), // Set the maximum number of threads
+		WithErrorHandler(func(err error) {
+			atomic.AddInt32(&handled, 1)
+		}))
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	errs := wp.WaitAll()
+	if len(errs) != 1 {
+		t.Fatalf("WaitAll() = %v, want one error", errs)
+	}
+	if _, ok := errs[0].(*TimeoutError); !ok {
+		t.Errorf("WaitAll() = %v, want a *TimeoutError", errs)
+	}
+	if n := atomic.LoadInt32(&handled); n != 1 {
+		t.Errorf("error handler called %v times, want 1", n)
+	}
+	if s := wp.Stats(); s.Failed != 1 || s.Timeouts != 1 {
+		t.Errorf("%v failed and %v timeouts, want 1 and 1", s.Failed, s.Timeouts)
+	}
+
+	// one ignoring its ctx and returning nil failed all the same. 忽略 ctx 并返回 nil 的任务同样失败
+	var completeErr error
+	wp = New(1, WithTimeout(5*time.Millisecond), WithFailFast(false), WithSilent(), // Set the maximum number of threads
+		WithOnComplete(func(elapsed time.Duration, err error) {
+			completeErr = err
+		}))
+	wp.Do(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	wp.Wait()
+	if s := wp.Stats(); s.Completed != 0 || s.Failed != 1 || s.Timeouts != 1 {
+		t.Errorf("%v completed, %v failed and %v timeouts, want 0, 1 and 1", s.Completed, s.Failed, s.Timeouts)
+	}
+	if _, ok := completeErr.(*TimeoutError); !ok {
+		t.Errorf("OnComplete got %v, want a *TimeoutError", completeErr)
+	}
+	fmt.Println("down")
+}
+
+// DoKeyed runs the tasks of a key on the same worker, a busy worker does not hold the others
+func TestWorkerPoolDoKeyed(t *testing.T) {
+	var wp *WorkPool
+	wp = New(4, WithKeyedRouting(), WithWorkerValue(func(id int) interface{} { // Set the maximum number of threads
+		return id
+	}, nil))
+	workers := make(map[string]map[int]bool)
+	for round := 0; round < 5; round++ {
+		for _, key := range []string{"a", "b", "c", "d", "e"} {
+			k := key
+			wp.push(&job{key: k, keyed: true, fn: func(ctx context.Context) error { // DoKeyed with the worker value. 同 DoKeyed
+				if workers[k] == nil {
+					workers[k] = make(map[int]bool)
+				}
+				workers[k][wp.WorkerValue(ctx).(int)] = true
+				return nil
+			}})
+			wp.WaitIdle()
+		}
+	}
+	for k, ids := range workers {
+		if len(ids) != 1 {
+			t.Errorf("key %v ran on workers %v, want one", k, ids)
+		}
+	}
+
+	// a stuck key overflows to the other workers. 某个 key 阻塞时其余任务由其他worker执行
+	release := make(chan struct{})
+	wp.DoKeyed("hot", func() error {
+		<-release
+		return nil
+	})
+	var n int32
+	for i := 0; i < 10; i++ {
+		wp.DoKeyed("hot", func() error {
+			atomic.AddInt32(&n, 1)
+			return nil
+		})
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&n) < 9 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if v := atomic.LoadInt32(&n); v < 9 {
+		t.Errorf("%v hot tasks ran while the worker of the key was stuck, want at least 9", v)
+	}
+	close(release)
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+	fmt.Println("down")
+}
+
+// RunAll runs the tasks on a pool of its own and leaves no goroutine behind
+func TestWorkerPoolRunAll(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var running, peak, n int32
+	fns := make([]TaskHandler, 20)
+	for i := range fns {
+		fns[i] = func() error {
+			v := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if v <= old || atomic.CompareAndSwapInt32(&peak, old, v) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&n, 1)
+			return nil
+		}
+	}
+	if err := RunAll(4, fns...); err != nil {
+		t.Error(err)
+	}
+	if n != 20 || peak > 4 {
+		t.Errorf("ran %v tasks with %v at once, want 20 with at most 4", n, peak)
+	}
+
+	err := RunAll(2, func() error { return nil }, func() error { return errors.New("my test err") })
+	if err == nil || err.Error() != "my test err" {
+		t.Errorf("RunAll() = %v, want my test err", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if g := runtime.NumGoroutine(); g > before {
+		t.Errorf("%v goroutines left, want %v", g, before)
+	}
+	fmt.Println("down")
+}
+
+// A huge max starts only the workers the tasks need
+func TestWorkerPoolHugeMax(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithSemaphore()}, {WithKeyedRouting()}} {
+		wp := New(10_000_000, opts...) // Set the maximum number of threads
+		for i := 0; i < 10; i++ {
+			wp.DoKeyed(fmt.Sprint(i), func() error {
+				return nil
+			})
+		}
+		if s := wp.Stats(); s.Workers > 10 || s.MaxWorkers != 10_000_000 {
+			t.Errorf("%v workers of %v, want at most one per task", s.Workers, s.MaxWorkers)
+		}
+		if err := wp.Wait(); err != nil {
+			t.Error(err)
+		}
+		if len(wp.lanes) > maxLanes {
+			t.Errorf("%v keyed queues, want at most %v", len(wp.lanes), maxLanes)
+		}
+	}
+	fmt.Println("down")
+}
+
+// The failed tasks reach the dead letter handler and can run again
+func TestWorkerPoolDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	var failed []TaskHandler
+	wp := New(2, WithFailFast(false), WithSilent(), WithDeadLetter(func(task TaskHandler, err error) { // Set the maximum number of threads
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, task)
+	}))
+	var attempts int32
+	for i := 0; i < 6; i++ {
+		ii := i
+		wp.Do(func() error {
+			if ii%2 == 1 && atomic.AddInt32(&attempts, 1) <= 3 { // fails the first time. 首次失败
+				return fmt.Errorf("err %v", ii)
+			}
+			return nil
+		})
+	}
+	wp.DoContext(func(ctx context.Context) error {
+		return errors.New("not a plain task")
+	})
+	multi, _ := wp.Wait().(*MultiError)
+	if multi == nil || len(multi.Errors()) != 4 {
+		t.Errorf("Wait() = %v, want every error", multi)
+	}
+	if len(failed) != 3 {
+		t.Fatalf("%v dead letters, want 3", len(failed))
+	}
+
+	if err := RunAll(2, failed...); err != nil {
+		t.Errorf("retry: %v", err)
+	}
+
+	// timed out tasks as well, even the ones returning nil afterwards. 超时的任务同样送入，即使之后返回 nil
+	var timedOut []error
+	wp = New(2, WithFailFast(false), WithSilent(), WithDeadLetter(func(task TaskHandler, err error) { // Set the maximum number of threads
+		mu.Lock()
+		defer mu.Unlock()
+		timedOut = append(timedOut, err)
+	}))
+	for i := 0; i < 2; i++ {
+		wp.DoTimeout(func() error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}, time.Millisecond)
+	}
+	wp.Wait()
+	if len(timedOut) != 2 {
+		t.Fatalf("%v dead letters, want 2", len(timedOut))
+	}
+	for _, err := range timedOut {
+		if _, ok := err.(*TimeoutError); !ok {
+			t.Errorf("dead letter error %v, want a *TimeoutError", err)
+		}
+	}
+	fmt.Println("down")
+}
+
+// DoAdmit reports once that the submission has to wait for queue space
+func TestWorkerPoolDoAdmit(t *testing.T) {
+	wp := New(1, WithQueueSize(1), WithBlockWhenFull(true)) // Set the maximum number of threads
+	var waits int32
+	onWait := func() { atomic.AddInt32(&waits, 1) }
+	release := make(chan struct{})
+	wp.DoAdmit(func() error {
+		<-release
+		return nil
+	}, onWait)
+	for wp.Running() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 2; i++ { // one held by the dispatcher, one queued. 分发协程持有一个，队列中一个
+		wp.DoAdmit(func() error { return nil }, onWait)
+		for wp.waitingQueue.Len() > 0 && i == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if v := atomic.LoadInt32(&waits); v != 0 {
+		t.Errorf("onWait called %v times with room in the queue", v)
+	}
+
+	res := make(chan error, 1)
+	go func() {
+		res <- wp.DoAdmit(func() error { return nil }, onWait)
+	}()
+	for atomic.LoadInt32(&waits) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-res:
+		t.Errorf("DoAdmit() = %v while the queue was full", err)
+	default:
+	}
+	close(release)
+	if err := <-res; err != nil {
+		t.Error(err)
+	}
+	wp.Wait()
+	if v := atomic.LoadInt32(&waits); v != 1 {
+		t.Errorf("onWait called %v times, want once", v)
+	}
+	fmt.Println("down")
+}
+
+// List the queued tasks, then take them out of the pool and run them elsewhere
+func TestWorkerPoolTakePending(t *testing.T) {
+	wp := New(1) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	for wp.Running() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	var order []int
+	for i := 0; i < 5; i++ {
+		ii := i
+		wp.DoPriority(func() error {
+			order = append(order, ii)
+			return nil
+		}, i%2) // odd ones first. 奇数优先
+		for i == 0 && wp.waitingQueue.Len() != 0 { // the dispatcher holds the first one. 分发协程持有第一个
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waited := make(chan error, 1)
+	go func() {
+		waited <- wp.DoWait(func() error { return nil })
+	}()
+	for wp.waitingQueue.Len() != 5 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if n := len(wp.PendingTasks()); n != 4 {
+		t.Errorf("%v pending tasks, want 4", n)
+	}
+	tasks := wp.TakePending()
+	if n := len(wp.PendingTasks()); n != 0 || len(tasks) != 4 {
+		t.Errorf("took %v tasks and %v are still pending, want 4 and 0", len(tasks), n)
+	}
+	if err := <-waited; err != ErrPoolClosed {
+		t.Errorf("DoWait() = %v, want ErrPoolClosed", err)
+	}
+	close(release)
+	if err := wp.WaitTimeout(time.Second); err != nil {
+		t.Error(err)
+	}
+	for _, task := range tasks {
+		task()
+	}
+	if fmt.Sprint(order) != "[0 1 3 2 4]" {
+		t.Errorf("order = %v, want the held task then the taken ones by priority", order)
+	}
+
+	// a DoSync whose task is taken returns. 任务被取出的 DoSync 返回
+	wp = New(1) // Set the maximum number of threads
+	release = make(chan struct{})
+	wp.Do(func() error {
+		<-release
+		return nil
+	})
+	for wp.Running() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	wp.Do(func() error { return nil })
+	for wp.waitingQueue.Len() != 0 { // the dispatcher holds it. 分发协程持有
+		time.Sleep(time.Millisecond)
+	}
+	synced := make(chan error, 1)
+	go func() {
+		synced <- wp.DoSync(func() error { return nil })
+	}()
+	for wp.waitingQueue.Len() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(wp.TakePending()); n != 1 {
+		t.Errorf("took %v tasks, want 1", n)
+	}
+	select {
+	case err := <-synced:
+		if err != ErrPoolClosed {
+			t.Errorf("DoSync() = %v, want ErrPoolClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("DoSync still blocked after TakePending")
+	}
+	close(release)
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// NewHTTPPool limits the requests per second and aborts the slow ones
+func TestWorkerPoolHTTPPool(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer srv.Close()
+
+	wp := NewHTTPPool(4, 100, 50*time.Millisecond, WithFailFast(false), WithSilent()) // Set the maximum number of threads
+	start := time.Now()
+	var ok int32
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e", "/f", "/g", "/h", "/i", "/slow"} {
+		url := srv.URL + path
+		wp.DoContext(func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			atomic.AddInt32(&ok, 1)
+			return nil
+		})
+	}
+	err := wp.Wait()
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("took %v, want the rate limit and the timeout to bound it", elapsed)
+	}
+	if s := wp.Stats(); ok != 9 || s.Timeouts != 1 || err == nil {
+		t.Errorf("%v requests ok, %v timed out, Wait() = %v, want 9, 1 and the timeout", ok, s.Timeouts, err)
+	}
+	fmt.Println("down")
+}
+
+// GoroutineCount drops to 0 after Wait and shows a task that outlives WaitTimeout
+func TestWorkerPoolGoroutineCount(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithSemaphore()}, {WithKeyedRouting()}} {
+		wp := New(3, opts...) // Set the maximum number of threads
+		release := make(chan struct{})
+		for i := 0; i < 6; i++ {
+			wp.DoKeyed(fmt.Sprint(i), func() error {
+				<-release
+				return nil
+			})
+		}
+		for wp.Running() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		if n := wp.GoroutineCount(); n < 3 || n > 6 {
+			t.Errorf("%v goroutines running 3 tasks", n)
+		}
+		close(release)
+		wp.Wait()
+		if n := wp.GoroutineCount(); n != 0 {
+			t.Errorf("%v goroutines after Wait, want 0", n)
+		}
+	}
+
+	wp := New(2, WithTimeout(time.Millisecond), WithSilent()) // Set the maximum number of threads
+	release := make(chan struct{})
+	wp.Do(func() error { // ignores its context. 忽略上下文
+		<-release
+		return nil
+	})
+	if err := wp.WaitTimeout(20 * time.Millisecond); err != ErrWaitTimeout {
+		t.Errorf("WaitTimeout() = %v, want ErrWaitTimeout", err)
+	}
+	if n := wp.GoroutineCount(); n != 1 {
+		t.Errorf("%v goroutines with a leaking task, want 1", n)
+	}
+	close(release)
+	for wp.GoroutineCount() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Println("down")
+}
+
+// WaitStats returns the counters of the finished run
+func TestWorkerPoolWaitStats(t *testing.T) {
+	wp := New(2, WithFailFast(false), WithSilent()) // Set the maximum number of threads
+	for i := 0; i < 3; i++ {
+		wp.Do(func() error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+	}
+	wp.Do(func() error { return errors.New("my test err") })
+	wp.Do(func() error { panic("my test panic") })
+	s, err := wp.WaitStats()
+	if err == nil {
+		t.Error("WaitStats() lost the error")
+	}
+	if s.Submitted != 5 || s.Completed != 3 || s.Failed != 2 || s.Panics != 1 || !s.Closed {
+		t.Errorf("WaitStats() = %+v, want 5 submitted, 3 completed, 2 failed, 1 panic", s)
+	}
+	if s.Elapsed < 5*time.Millisecond {
+		t.Errorf("Elapsed = %v, want at least 5ms", s.Elapsed)
+	}
+	if again, _ := wp.WaitStats(); again != s {
+		t.Errorf("second WaitStats() = %+v, want the same %+v", again, s)
+	}
+	fmt.Println("down")
+}
+
+// The timer wheel keeps the timeout semantics
+func TestWorkerPoolTimerWheel(t *testing.T) {
+	wp := New(4, WithTimeout(20*time.Millisecond), WithTimerWheel(time.Millisecond), WithSilent()) // Set the maximum number of threads
+	canceled := make(chan error, 1)
+	wp.DoContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return ctx.Err()
+	})
+	for i := 0; i < 100; i++ {
+		wp.Do(func() error { // stop their timers. 停止定时器
+			return nil
+		})
+	}
+	start := time.Now()
+	if err := <-canceled; err != context.DeadlineExceeded {
+		t.Errorf("ctx.Err() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, ok := wp.Wait().(*TimeoutError); !ok {
+		t.Error("Wait() lost the timeout")
+	}
+	if s := wp.Stats(); s.Timeouts != 1 || s.Completed != 100 || time.Since(start) > time.Second {
+		t.Errorf("%v timeouts and %v completed, want 1 and 100", s.Timeouts, s.Completed)
+	}
+
+	// the wheel stops ticking once no timer is pending. 无定时器时时间轮停止
+	w := newTimerWheel(time.Millisecond)
+	fired := make(chan struct{})
+	w.AfterFunc(3*time.Millisecond, func() { close(fired) })
+	stopped := w.AfterFunc(wheelSlots*time.Millisecond+time.Millisecond, func() { t.Error("stopped timer fired") })
+	<-w.NewTimer(2 * time.Millisecond).C()
+	<-fired
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop() must report only the first stop of a pending timer")
+	}
+	time.Sleep(5 * time.Millisecond)
+	w.mu.Lock()
+	running := w.running
+	w.mu.Unlock()
+	if running {
+		t.Error("the wheel still runs without pending timers")
+	}
+	fmt.Println("down")
+}
+
+// Timers started while the wheel is already ticking never fire before their delay
+func TestWorkerPoolTimerWheelNotEarly(t *testing.T) {
+	const tick = 10 * time.Millisecond
+	w := newTimerWheel(tick)
+	keep := w.AfterFunc(time.Minute, func() {}) // keeps the wheel ticking. 保持时间轮运行
+	defer keep.Stop()
+	for i := 0; i < 10; i++ {
+		time.Sleep(tick * time.Duration(i) / 10) // at any point between two ticks. 两个 tick 之间的任意时刻
+		start := time.Now()
+		<-w.NewTimer(tick).C()
+		if d := time.Since(start); d < tick {
+			t.Errorf("timer fired after %v, want at least %v", d, tick)
+		}
+	}
+
+	// the task context is not done before its deadline. 任务上下文不会早于截止时间结束
+	wp := New(1, WithTimerWheel(tick), WithTimeout(tick), WithSilent()) // Set the maximum number of threads
+	for i := 0; i < 5; i++ {
+		wp.DoContext(func(ctx context.Context) error {
+			deadline, _ := ctx.Deadline()
+			<-ctx.Done()
+			if now := time.Now(); now.Before(deadline) {
+				t.Errorf("ctx done %v before its deadline", deadline.Sub(now))
+			}
+			return ctx.Err()
+		})
+	}
+	wp.Wait()
+	fmt.Println("down")
+}
+
+// Tiny tasks with a timeout on the shared timer wheel, compare with BenchmarkWorkPoolTimeout
+func BenchmarkWorkPoolTimerWheel(b *testing.B) {
+	wp := New(8, WithTimeout(time.Second), WithTimerWheel(time.Millisecond)) // Set the maximum number of threads
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wp.Do(func() error {
+			return nil
+		})
+	}
+	wp.Wait()
+}
+
+// Burst adds workers for a while, then the extra ones retire on their own
+func TestWorkerPoolBurst(t *testing.T) {
+	clock := newFakeClock()
+	wp := New(1, WithClock(clock)) // Set the maximum number of threads
+	wp.Burst(2, time.Minute)
+	if n := wp.MaxWorkers(); n != 3 {
+		t.Errorf("MaxWorkers() = %v during the burst, want 3", n)
+	}
+
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		wp.Do(func() error {
+			<-release
+			return nil
+		})
+	}
+	for wp.Running() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a Resize during the burst sets the base size. 期间的Resize调整基础大小
+	wp.Resize(2)
+	if n := wp.MaxWorkers(); n != 4 {
+		t.Errorf("MaxWorkers() = %v after Resize(2), want 4", n)
+	}
+	clock.Advance(time.Minute)
+	for wp.MaxWorkers() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for wp.Stats().Workers > 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := wp.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	// a burst running out while the pool is stopped. 工作池停止期间结束的临时扩容
+	wp.Reset()
+	wp.Burst(3, time.Minute)
+	wp.Wait()
+	clock.Advance(time.Minute)
+	for wp.MaxWorkers() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	wp.Reset()
+	if n := wp.MaxWorkers(); n != 2 {
+		t.Errorf("MaxWorkers() = %v after Reset, want 2", n)
+	}
+	wp.Wait()
+
+	// the timer of a burst ending around Reset, see go test -race. 在 Reset 前后结束的临时扩容
+	wp = New(1) // Set the maximum number of threads
+	for i := 0; i < 10; i++ {
+		wp.Burst(1, time.Duration(i)*100*time.Microsecond)
+		wp.Wait()
+		time.Sleep(500 * time.Microsecond)
+		wp.Reset()
+	}
+	for wp.MaxWorkers() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	wp.Wait()
+	fmt.Println("down")
+}